@@ -1,6 +1,7 @@
 package http_client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,19 +9,14 @@ import (
 	"net/url"
 	"os"
 	"stockbackend/types"
-	"strings"
 
 	"go.uber.org/zap"
 )
 
-func SearchCompany(queryString string) ([]types.Company, error) {
-	// Replace "corporation" with "Corpn" and "limited" with "Ltd"
-	queryString = strings.ReplaceAll(queryString, " Corporation ", " Corpn ")
-	queryString = strings.ReplaceAll(queryString, " corporation ", " Corpn ")
-	queryString = strings.ReplaceAll(queryString, " Limited", " Ltd ")
-	queryString = strings.ReplaceAll(queryString, " limited", " Ltd ")
-	queryString = strings.ReplaceAll(queryString, " and ", " & ")
-	queryString = strings.ReplaceAll(queryString, " And ", " & ")
+// SearchCompany searches the company database for the query as given;
+// callers spell it the way the database does with names.SearchQuery. The
+// request is abandoned when ctx is cancelled.
+func SearchCompany(ctx context.Context, queryString string) ([]types.Company, error) {
 	// Base URL for the Screener API
 	baseURL := os.Getenv("COMPANY_URL") + "/api/company/search/"
 
@@ -31,7 +27,7 @@ func SearchCompany(queryString string) ([]types.Company, error) {
 	params.Add("fts", "1")
 
 	// Create the request
-	req, err := http.NewRequest("GET", baseURL+"?"+params.Encode(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"?"+params.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -61,13 +57,20 @@ func SearchCompany(queryString string) ([]types.Company, error) {
 	return searchResponse, nil
 }
 
-func GetCompanyPage(url string) (io.ReadCloser, error) {
-	resp, err := http.Get(url)
+// GetCompanyPage fetches a company page; the request is abandoned when
+// ctx is cancelled
+func GetCompanyPage(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch the URL: %v", err)
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the URL: %w", err)
 	}
 
 	if resp.StatusCode != 200 {
+		resp.Body.Close()
 		return nil, fmt.Errorf("failed to retrieve the content, status code: %d", resp.StatusCode)
 	}
 
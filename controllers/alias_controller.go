@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"errors"
+	"stockbackend/services"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type AliasControllerI interface {
+	ListAliases(ctx *gin.Context)
+	AddAlias(ctx *gin.Context)
+	ConfirmAlias(ctx *gin.Context)
+}
+
+type aliasController struct{}
+
+var AliasController AliasControllerI = &aliasController{}
+
+type addAliasRequest struct {
+	Alias     string `json:"alias" binding:"required"`
+	CompanyID string `json:"companyId" binding:"required"`
+}
+
+// ListAliases lists company aliases, only confirmed or unconfirmed ones
+// with the confirmed query parameter
+func (a *aliasController) ListAliases(ctx *gin.Context) {
+	filter := services.AliasFilter{}
+	filter.Page, _ = strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(ctx.Query("pageSize"))
+	if value := ctx.Query("confirmed"); value != "" {
+		confirmed, err := strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "confirmed must be true or false"})
+			return
+		}
+		filter.Confirmed = &confirmed
+	}
+	aliases, err := services.AliasService.List(ctx, filter)
+	if err != nil {
+		aliasError(ctx, err)
+		return
+	}
+	ctx.JSON(200, gin.H{"aliases": aliases, "page": max(filter.Page, 1)})
+}
+
+// AddAlias confirms that a name is an alias of a company, correcting the
+// alias if it was learned wrong
+func (a *aliasController) AddAlias(ctx *gin.Context) {
+	var request addAliasRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "Expected a JSON body with alias and companyId"})
+		return
+	}
+	alias, err := services.AliasService.Add(ctx, request.Alias, request.CompanyID)
+	if err != nil {
+		aliasError(ctx, err)
+		return
+	}
+	ctx.JSON(200, alias)
+}
+
+func (a *aliasController) ConfirmAlias(ctx *gin.Context) {
+	alias, err := services.AliasService.Confirm(ctx, ctx.Param("id"))
+	if err != nil {
+		aliasError(ctx, err)
+		return
+	}
+	ctx.JSON(200, alias)
+}
+
+func aliasError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAliasNotFound):
+		ctx.JSON(404, gin.H{"error": "Alias not found"})
+	case errors.Is(err, services.ErrCompanyNotFound):
+		ctx.JSON(404, gin.H{"error": "Company not found"})
+	case errors.Is(err, services.ErrInvalidAlias):
+		ctx.JSON(400, gin.H{"error": "Alias has no letters or digits"})
+	default:
+		zap.L().Error("Error handling alias request", zap.Error(err))
+		sentry.CaptureException(err)
+		ctx.JSON(500, gin.H{"error": "Error handling alias request"})
+	}
+}
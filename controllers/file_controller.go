@@ -1,13 +1,24 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"mime/multipart"
+	"net/http"
 	"stockbackend/services"
+	"stockbackend/utils/events"
+	"stockbackend/utils/export"
+	"stockbackend/utils/holdings"
+	"stockbackend/utils/upload"
+	"strings"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
 )
 
 type FileControllerI interface {
@@ -24,11 +35,10 @@ func (f *fileController) ParseXLSXFile(ctx *gin.Context) {
 	defer span.Finish()
 
 	// Parse the form and retrieve the uploaded files
-	form, err := ctx.MultipartForm()
+	limits := upload.LimitsFromEnv()
+	form, err := multipartForm(ctx, limits)
 	if err != nil {
-		span.Status = sentry.SpanStatusFailedPrecondition
-		sentry.CaptureException(err)
-		ctx.JSON(400, gin.H{"error": "Error parsing form data"})
+		uploadError(ctx, span, err)
 		return
 	}
 
@@ -39,65 +49,239 @@ func (f *fileController) ParseXLSXFile(ctx *gin.Context) {
 		return
 	}
 
-	uploadDir := "./uploads"
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		span.Status = sentry.SpanStatusFailedPrecondition
-		sentry.CaptureException(err)
-		ctx.JSON(500, gin.H{"error": "Error creating upload directory"})
+	// mode=offline only answers from the database: nothing is scraped or stored
+	offline, err := offlineMode(ctx.Query("mode"))
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	var savedFilePaths = make(chan string, len(files))
-	for _, file := range files {
-		src, err := file.Open()
-		if err != nil {
-			span.Status = sentry.SpanStatusFailedPrecondition
-			sentry.CaptureException(err)
-			ctx.JSON(500, gin.H{"error": "Error opening file"})
-			return
-		}
-		defer src.Close()
+	format, err := outputFormat(ctx, events.FormatNDJSON, events.FormatSSE, formatXLSX)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, savedFilePaths, err := saveUploads(limits, files)
+	if err != nil {
+		uploadError(ctx, span, err)
+		return
+	}
+	defer session.Cleanup()
 
-		filename := filepath.Base(file.Filename)
-		savePath := filepath.Join(uploadDir, filename)
+	// Only the schemes named in ?schemes= are scored, when it is given
+	opts := services.ParseOptions{Schemes: holdings.ParseSchemeFilter(ctx.QueryArray("schemes")), Offline: offline}
 
-		dst, err := os.Create(savePath)
+	// In async mode the upload is handed to a background worker and the
+	// client polls /api/jobs/:id for progress and the results
+	if ctx.Query("async") == "true" {
+		// The job owns the uploaded files from here on
+		cleanup := session.Detach()
+		job, err := services.JobService.Submit(savedFilePaths, opts, cleanup)
 		if err != nil {
-			span.Status = sentry.SpanStatusFailedPrecondition
+			cleanup()
+			span.Status = sentry.SpanStatusResourceExhausted
 			sentry.CaptureException(err)
-			ctx.JSON(500, gin.H{"error": "Error creating file on server"})
+			ctx.JSON(503, gin.H{"error": err.Error()})
 			return
 		}
-		defer dst.Close()
+		resultURL := "/api/jobs/" + job.ID + "/result"
+		if format == formatXLSX {
+			resultURL += "?format=xlsx"
+		}
+		span.Status = sentry.SpanStatusOK
+		ctx.JSON(202, gin.H{
+			"jobId":     job.ID,
+			"status":    job.Status,
+			"statusUrl": "/api/jobs/" + job.ID,
+			"resultUrl": resultURL,
+		})
+		return
+	}
+
+	filePaths := make(chan string, len(savedFilePaths))
+	for _, savePath := range savedFilePaths {
+		filePaths <- savePath
+	}
+	close(filePaths)
+
+	// Scoring stops as soon as the client goes away
+	requestCtx := ctx.Request.Context()
 
-		if _, err := io.Copy(dst, src); err != nil {
+	// The workbook can only be built once every sheet has been scored
+	if format == formatXLSX {
+		var records bufferedStream
+		if err := services.FileService.ParseXLSXFile(requestCtx, events.NewStream(&records, events.FormatNDJSON), filePaths, opts, span.Context()); err != nil {
+			if errors.Is(err, context.Canceled) {
+				span.Status = sentry.SpanStatusCanceled
+				return
+			}
 			span.Status = sentry.SpanStatusFailedPrecondition
 			sentry.CaptureException(err)
-			ctx.JSON(500, gin.H{"error": "Error saving file"})
+			ctx.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		sendWorkbook(ctx, span, &records.Buffer, "portfolio-analysis.xlsx")
+		return
+	}
 
-		savedFilePaths <- savePath
+	stream := startStream(ctx, format)
+	err = services.FileService.ParseXLSXFile(requestCtx, stream, filePaths, opts, span.Context())
+	finishStream(span, stream, err)
+}
+
+// outputFormat reads the format query parameter, which must be one of
+// formats. Without one, clients accepting text/event-stream get SSE and
+// the others NDJSON.
+func outputFormat(ctx *gin.Context, formats ...string) (string, error) {
+	format := ctx.Query("format")
+	if format == "" {
+		format = events.FormatFor(ctx.GetHeader("Accept"))
 	}
-	close(savedFilePaths)
+	for _, allowed := range formats {
+		if format == allowed {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q: use %s", format, strings.Join(formats, ", "))
+}
 
-	// Set headers for chunked transfer (if needed)
-	ctx.Writer.Header().Set("Content-Type", "text/plain")
+// startStream sends the headers of an event stream. Errors past this
+// point are sent as events, as the status has already gone out.
+func startStream(ctx *gin.Context, format string) *events.Stream {
+	stream := events.NewStream(ctx.Writer, format)
+	ctx.Writer.Header().Set("Content-Type", stream.ContentType())
 	ctx.Writer.Header().Set("Cache-Control", "no-cache")
 	ctx.Writer.Header().Set("Connection", "keep-alive")
+	ctx.Writer.Header().Set("X-Accel-Buffering", "no")
+	ctx.Status(200)
+	ctx.Writer.WriteHeaderNow()
+	return stream
+}
 
-	err = services.FileService.ParseXLSXFile(ctx, savedFilePaths, span.Context())
-	if err != nil {
+// finishStream ends an event stream with its done event and records how
+// the run went on the span. A client that went away is recorded as
+// cancelled rather than failed, and is sent nothing more.
+func finishStream(span *sentry.Span, stream *events.Stream, err error) {
+	switch {
+	case errors.Is(err, context.Canceled) || stream.Err() != nil:
+		span.Status = sentry.SpanStatusCanceled
+		return
+	case err != nil:
 		span.Status = sentry.SpanStatusFailedPrecondition
 		sentry.CaptureException(err)
+	default:
+		span.Status = sentry.SpanStatusOK
+	}
+	if err := stream.Close(err); err != nil {
+		zap.L().Error("Error closing stream", zap.Error(err))
+	}
+}
+
+// formatXLSX sends an enriched workbook once every sheet has been scored,
+// instead of streaming the events of an upload
+const formatXLSX = "xlsx"
+
+// bufferedStream collects the events of an upload in memory
+type bufferedStream struct {
+	bytes.Buffer
+}
+
+func (b *bufferedStream) Flush() {}
+
+// sendWorkbook builds the enriched workbook from the NDJSON events of an
+// upload and sends it as an attachment
+func sendWorkbook(ctx *gin.Context, span *sentry.Span, records io.Reader, filename string) {
+	schemes, err := export.ReadNDJSON(records)
+	if err == nil && len(schemes) == 0 {
+		err = errors.New("no holdings found")
+	}
+	var f *excelize.File
+	if err == nil {
+		f, err = export.Workbook(schemes)
+	}
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		sentry.CaptureException(err)
+		zap.L().Error("Error exporting workbook", zap.Error(err))
 		ctx.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	defer f.Close()
 
 	span.Status = sentry.SpanStatusOK
-	if _, err := ctx.Writer.Write([]byte("\nStream complete.\n")); err != nil {
-		ctx.JSON(500, gin.H{"error": "Error streaming"})
-		return
+	ctx.Header("Content-Type", export.ContentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := f.Write(ctx.Writer); err != nil {
+		zap.L().Error("Error writing workbook", zap.Error(err))
 	}
+}
+
+// offlineMode reads the mode query parameter: "offline", or "online" (the
+// default)
+func offlineMode(mode string) (bool, error) {
+	switch mode {
+	case "", "online":
+		return false, nil
+	case "offline":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown mode %q: use online or offline", mode)
+}
 
-	ctx.Writer.Flush() // Ensure the final response is sent
+// multipartForm parses the form of an upload request, refusing bodies
+// larger than the request limit before they are read. The limit leaves
+// room for the multipart framing around the files.
+func multipartForm(ctx *gin.Context, limits upload.Limits) (*multipart.Form, error) {
+	if limits.MaxRequestBytes > 0 {
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limits.MaxRequestBytes+multipartOverhead)
+	}
+	form, err := ctx.MultipartForm()
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, upload.ErrRequestTooLarge
+	}
+	return form, err
+}
+
+// multipartOverhead is the allowance for form boundaries and headers
+const multipartOverhead = 1 << 20
+
+// saveUploads checks the files of a request and saves them into a new
+// upload session. On success the caller must Cleanup (or Detach) the
+// session; on error it is already cleaned up.
+func saveUploads(limits upload.Limits, files []*multipart.FileHeader) (*upload.Session, []string, error) {
+	session, err := upload.NewSession(limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		path, err := session.Save(file)
+		if err != nil {
+			session.Cleanup()
+			return nil, nil, err
+		}
+		paths = append(paths, path)
+	}
+	return session, paths, nil
+}
+
+// uploadError answers a rejected upload with the matching status
+func uploadError(ctx *gin.Context, span *sentry.Span, err error) {
+	span.Status = sentry.SpanStatusInvalidArgument
+	switch {
+	case errors.Is(err, upload.ErrFileTooLarge), errors.Is(err, upload.ErrRequestTooLarge), errors.Is(err, upload.ErrTooManyFiles):
+		ctx.JSON(413, gin.H{"error": err.Error()})
+	case errors.Is(err, upload.ErrUnsupportedType):
+		ctx.JSON(415, gin.H{"error": err.Error()})
+	case errors.Is(err, upload.ErrCompressionBomb):
+		ctx.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, http.ErrNotMultipart), errors.Is(err, http.ErrMissingBoundary):
+		ctx.JSON(400, gin.H{"error": "Error parsing form data"})
+	default:
+		span.Status = sentry.SpanStatusInternalError
+		zap.L().Error("Error saving upload", zap.Error(err))
+		sentry.CaptureException(err)
+		ctx.JSON(500, gin.H{"error": "Error saving file"})
+	}
 }
@@ -10,6 +10,7 @@ import (
 	"os"
 	"regexp"
 	"stockbackend/services"
+	"stockbackend/utils/events"
 	"strings"
 	"sync"
 	"time"
@@ -72,6 +73,11 @@ func (g *gmailController) GetEmails(ctx *gin.Context) {
 	defer sentrySpan.Finish()
 
 	accessToken := ctx.PostForm("token")
+	format, err := outputFormat(ctx, events.FormatNDJSON, events.FormatSSE)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	sixMonthsAgo := time.Now().AddDate(0, -6, 0).Format("2006-01-02")
 
 	url := fmt.Sprintf("https://gmail.googleapis.com/gmail/v1/users/me/messages?q=after:%s+portfolio+disclosure", sixMonthsAgo)
@@ -138,15 +144,9 @@ func (g *gmailController) GetEmails(ctx *gin.Context) {
 	}()
 
 	// Process XLSX files
-	err = services.FileService.ParseXLSXFile(ctx, fileList, sentrySpan.Context())
-	if err != nil {
-		sentrySpan.Status = sentry.SpanStatusFailedPrecondition
-		sentry.CaptureException(err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	ctx.JSON(http.StatusOK, gin.H{"status": "Files processed successfully"})
+	stream := startStream(ctx, format)
+	err = services.FileService.ParseXLSXFile(ctx.Request.Context(), stream, fileList, services.ParseOptions{}, sentrySpan.Context())
+	finishStream(sentrySpan, stream, err)
 }
 
 func fetchEmailDetails(accessToken, emailID string, fileList chan<- string, wg *sync.WaitGroup, sentrySpan *sentry.Span) {
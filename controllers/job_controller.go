@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"os"
+	"stockbackend/services"
+	"stockbackend/types"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+)
+
+type JobControllerI interface {
+	GetJob(ctx *gin.Context)
+	GetJobResult(ctx *gin.Context)
+}
+
+type jobController struct{}
+
+var JobController JobControllerI = &jobController{}
+
+func (j *jobController) GetJob(ctx *gin.Context) {
+	job, ok := services.JobService.Get(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(404, gin.H{"error": "Job not found"})
+		return
+	}
+	ctx.JSON(200, job)
+}
+
+func (j *jobController) GetJobResult(ctx *gin.Context) {
+	job, ok := services.JobService.Get(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(404, gin.H{"error": "Job not found"})
+		return
+	}
+	if job.Status != types.JobCompleted {
+		ctx.JSON(409, gin.H{"error": "Job has not completed", "status": job.Status})
+		return
+	}
+
+	resultPath := services.JobService.ResultPath(job.ID)
+	if _, err := os.Stat(resultPath); err != nil {
+		ctx.JSON(404, gin.H{"error": "Job result not found"})
+		return
+	}
+
+	if ctx.Query("format") == formatXLSX {
+		span := sentry.StartSpan(ctx.Request.Context(), "[GIN] ExportJobResult", sentry.WithTransactionName("ExportJobResult"))
+		defer span.Finish()
+		result, err := os.Open(resultPath)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		defer result.Close()
+		sendWorkbook(ctx, span, result, job.ID+".xlsx")
+		return
+	}
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.FileAttachment(resultPath, job.ID+".ndjson")
+}
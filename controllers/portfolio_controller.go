@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"errors"
+	"mime/multipart"
+	"stockbackend/services"
+	"stockbackend/types"
+	"stockbackend/utils/holdings"
+	"stockbackend/utils/upload"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type PortfolioControllerI interface {
+	ListPortfolios(ctx *gin.Context)
+	GetPortfolio(ctx *gin.Context)
+	GetPortfolioChanges(ctx *gin.Context)
+	CompareUploads(ctx *gin.Context)
+}
+
+type portfolioController struct{}
+
+var PortfolioController PortfolioControllerI = &portfolioController{}
+
+// ListPortfolios lists stored portfolios, filtered by the amc, scheme, from
+// and to query parameters
+func (p *portfolioController) ListPortfolios(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(ctx.Query("pageSize"))
+	portfolios, err := services.PortfolioService.List(ctx, services.PortfolioFilter{
+		AMC:      ctx.Query("amc"),
+		Scheme:   ctx.Query("scheme"),
+		From:     ctx.Query("from"),
+		To:       ctx.Query("to"),
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		zap.L().Error("Error listing portfolios", zap.Error(err))
+		sentry.CaptureException(err)
+		ctx.JSON(500, gin.H{"error": "Error listing portfolios"})
+		return
+	}
+	ctx.JSON(200, gin.H{"portfolios": portfolios, "page": max(page, 1)})
+}
+
+func (p *portfolioController) GetPortfolio(ctx *gin.Context) {
+	portfolio, err := services.PortfolioService.Get(ctx, ctx.Param("id"))
+	if err != nil {
+		portfolioError(ctx, err)
+		return
+	}
+	ctx.JSON(200, portfolio)
+}
+
+// GetPortfolioChanges compares a stored portfolio with the one given by the
+// previous query parameter, or else with the latest earlier portfolio of
+// the same scheme
+func (p *portfolioController) GetPortfolioChanges(ctx *gin.Context) {
+	current, err := services.PortfolioService.Get(ctx, ctx.Param("id"))
+	if err != nil {
+		portfolioError(ctx, err)
+		return
+	}
+
+	var previous types.Portfolio
+	if previousID := ctx.Query("previous"); previousID != "" {
+		previous, err = services.PortfolioService.Get(ctx, previousID)
+	} else {
+		previous, err = services.PortfolioService.Previous(ctx, current)
+	}
+	if errors.Is(err, services.ErrPortfolioNotFound) {
+		ctx.JSON(404, gin.H{"error": "No earlier portfolio to compare with"})
+		return
+	}
+	if err != nil {
+		portfolioError(ctx, err)
+		return
+	}
+	ctx.JSON(200, holdings.Diff(previous, current))
+}
+
+// CompareUploads compares the schemes of two uploaded disclosures, sent as
+// the "previous" and "current" form files
+func (p *portfolioController) CompareUploads(ctx *gin.Context) {
+	defer sentry.Recover()
+	span := sentry.StartSpan(ctx.Request.Context(), "[GIN] CompareUploads", sentry.WithTransactionName("CompareUploads"))
+	defer span.Finish()
+
+	limits := upload.LimitsFromEnv()
+	form, err := multipartForm(ctx, limits)
+	if err != nil {
+		uploadError(ctx, span, err)
+		return
+	}
+	fields := []string{"previous", "current"}
+	var files []*multipart.FileHeader
+	for _, field := range fields {
+		if len(form.File[field]) == 0 {
+			span.Status = sentry.SpanStatusInvalidArgument
+			ctx.JSON(400, gin.H{"error": "Missing file " + field})
+			return
+		}
+		files = append(files, form.File[field][0])
+	}
+	session, savePaths, err := saveUploads(limits, files)
+	if err != nil {
+		uploadError(ctx, span, err)
+		return
+	}
+	defer session.Cleanup()
+
+	var workbooks [2][]types.Portfolio
+	for i, field := range fields {
+		workbooks[i], err = services.FileService.ExtractPortfolios(ctx, savePaths[i], span.Context())
+		if err != nil {
+			span.Status = sentry.SpanStatusInternalError
+			sentry.CaptureException(err)
+			ctx.JSON(500, gin.H{"error": "Error reading " + field})
+			return
+		}
+	}
+
+	pairs, unmatched := holdings.PairSchemes(workbooks[0], workbooks[1])
+	changes := make([]types.PortfolioChanges, 0, len(pairs))
+	for _, pair := range pairs {
+		changes = append(changes, holdings.Diff(pair[0], pair[1]))
+	}
+	span.Status = sentry.SpanStatusOK
+	ctx.JSON(200, gin.H{"changes": changes, "unmatchedSchemes": unmatched})
+}
+
+func portfolioError(ctx *gin.Context, err error) {
+	if errors.Is(err, services.ErrPortfolioNotFound) {
+		ctx.JSON(404, gin.H{"error": "Portfolio not found"})
+		return
+	}
+	zap.L().Error("Error fetching portfolio", zap.Error(err))
+	sentry.CaptureException(err)
+	ctx.JSON(500, gin.H{"error": "Error fetching portfolio"})
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"errors"
+	"stockbackend/services"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type SecurityMasterControllerI interface {
+	ImportSecurities(ctx *gin.Context)
+	GetSecurity(ctx *gin.Context)
+}
+
+type securityMasterController struct{}
+
+var SecurityMasterController SecurityMasterControllerI = &securityMasterController{}
+
+type importSecuritiesRequest struct {
+	Files []string `json:"files" binding:"required,min=1"`
+}
+
+// ImportSecurities imports the named exchange equity master CSVs from
+// SECURITY_MASTER_DIR into the security master
+func (s *securityMasterController) ImportSecurities(ctx *gin.Context) {
+	var request importSecuritiesRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(400, gin.H{"error": "Expected a JSON body with the files to import"})
+		return
+	}
+	results, err := services.SecurityMasterService.Import(ctx, request.Files)
+	if errors.Is(err, services.ErrInvalidMasterFile) {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		zap.L().Error("Error importing security master", zap.Error(err))
+		sentry.CaptureException(err)
+		ctx.JSON(500, gin.H{"error": "Error importing security master"})
+		return
+	}
+	ctx.JSON(200, gin.H{"files": results})
+}
+
+func (s *securityMasterController) GetSecurity(ctx *gin.Context) {
+	security, err := services.SecurityMasterService.Get(ctx, ctx.Param("isin"))
+	if errors.Is(err, services.ErrSecurityNotFound) {
+		ctx.JSON(404, gin.H{"error": "Security not found"})
+		return
+	}
+	if err != nil {
+		zap.L().Error("Error fetching security", zap.Error(err))
+		sentry.CaptureException(err)
+		ctx.JSON(500, gin.H{"error": "Error fetching security"})
+		return
+	}
+	ctx.JSON(200, security)
+}
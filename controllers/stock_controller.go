@@ -1,12 +1,13 @@
 package controllers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"os"
 	mongo_client "stockbackend/clients/mongo"
 	"stockbackend/services"
+	"stockbackend/utils/events"
 	"stockbackend/utils/helpers"
 	"strconv"
 	"time"
@@ -36,6 +37,11 @@ func (s *stockController) GetStocks(ctx *gin.Context) {
 		ctx.JSON(400, gin.H{"error": "Invalid page number"})
 		return
 	}
+	format, err := outputFormat(ctx, events.FormatNDJSON, events.FormatSSE)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 	// fetch the stocks from the database
 	collection := mongo_client.Client.Database(os.Getenv("DATABASE")).Collection(os.Getenv("COLLECTION"))
 
@@ -50,11 +56,12 @@ func (s *stockController) GetStocks(ctx *gin.Context) {
 		return
 	}
 	defer cursor.Close(ctx)
+	stream := startStream(ctx, format)
 	for cursor.Next(ctx) {
 		var result bson.M
 		err := cursor.Decode(&result)
 		if err != nil {
-			ctx.JSON(500, gin.H{"error": "Error while decoding stocks"})
+			stream.Close(errors.New("error while decoding stocks"))
 			return
 		}
 		stockDetail := make(map[string]interface{})
@@ -63,23 +70,12 @@ func (s *stockController) GetStocks(ctx *gin.Context) {
 		stockDetail["url"] = result["url"]
 		stockDetail["marketCap"] = helpers.GetMarketCapCategory(fmt.Sprintf("%v", result["marketCap"]))
 		stockDetail["stockRate"] = result["rank"]
-		fmt.Println(result["fScore"], "fScore")
 		stockDetail["fScore"] = result["fScore"]
-		stockDataMarshal, err := json.Marshal(stockDetail)
-		if err != nil {
-			zap.L().Error("Error marshalling data", zap.Error(err))
-			continue
-		}
-
-		_, err = ctx.Writer.Write(append(stockDataMarshal, '\n')) // Send each stockDetail as JSON with a newline separator
-
-		if err != nil {
-			zap.L().Error("Error writing data", zap.Error(err))
-			break
+		if stream.Deliver(events.TypeRecord, stockDetail) != nil {
+			return
 		}
-		ctx.Writer.Flush() // Flush each chunk immediately to the client
 	}
-	ctx.JSON(200, gin.H{"message": "Stocks are fetched"})
+	stream.Close(cursor.Err())
 }
 
 func (s *stockController) UpdateCompanyData(ctx *gin.Context) {
@@ -133,7 +129,7 @@ func (s *stockController) GetInvestmentRecommendation(ctx *gin.Context) {
 		zap.Any("_id", companyID))
 
 	// Fetch fresh company data from external source
-	freshCompanyData, err := helpers.FetchCompanyData(url)
+	freshCompanyData, err := helpers.FetchCompanyData(ctx.Request.Context(), url)
 	if err != nil {
 		zap.L().Error("Error fetching fresh company data",
 			zap.String("company", companyNameFromDB),
@@ -238,6 +234,11 @@ func (s *stockController) GetStocksWithRecommendations(ctx *gin.Context) {
 		ctx.JSON(400, gin.H{"error": "Invalid page number"})
 		return
 	}
+	format, err := outputFormat(ctx, events.FormatNDJSON, events.FormatSSE)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Parse recommendation filter (optional)
 	recommendationFilter := ctx.Query("recommendation") // BUY, SELL, HOLD
@@ -267,12 +268,13 @@ func (s *stockController) GetStocksWithRecommendations(ctx *gin.Context) {
 	}
 	defer cursor.Close(ctx)
 
+	stream := startStream(ctx, format)
 	for cursor.Next(ctx) {
 		var result bson.M
 		err := cursor.Decode(&result)
 		if err != nil {
 			zap.L().Error("Error while decoding stocks", zap.Error(err))
-			ctx.JSON(500, gin.H{"error": "Error while decoding stocks"})
+			stream.Close(errors.New("error while decoding stocks"))
 			return
 		}
 
@@ -304,20 +306,10 @@ func (s *stockController) GetStocksWithRecommendations(ctx *gin.Context) {
 		stockDetail["peerComparisonScore"] = result["peerComparisonScore"]
 		stockDetail["trendScore"] = result["trendScore"]
 
-		stockDataMarshal, err := json.Marshal(stockDetail)
-		if err != nil {
-			zap.L().Error("Error marshalling data", zap.Error(err))
-			continue
-		}
-
-		// Send each stockDetail as JSON with a newline separator
-		_, err = ctx.Writer.Write(append(stockDataMarshal, '\n'))
-		if err != nil {
-			zap.L().Error("Error writing data", zap.Error(err))
-			break
+		// Send each stockDetail as its own record
+		if stream.Deliver(events.TypeRecord, stockDetail) != nil {
+			return
 		}
-		ctx.Writer.Flush() // Flush each chunk immediately to the client
 	}
-
-	ctx.JSON(200, gin.H{"message": "Stocks with investment recommendations fetched"})
+	stream.Close(cursor.Err())
 }
@@ -46,7 +46,7 @@ func CORSMiddleware() gin.HandlerFunc {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, trell-auth-token, trell-app-version-int, creator-space-auth-token")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Admin-Token, trell-auth-token, trell-app-version-int, creator-space-auth-token")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -120,6 +120,7 @@ func main() {
 	ticker := startTicker()
 	rankUpdater := startRankUpdater()
 	companyDataUpdater := startCompanyDataUpdater()
+	startJobWorkers()
 	routes.Routes(router)
 
 	port := os.Getenv("PORT")
@@ -190,3 +191,12 @@ func startCompanyDataUpdater() *time.Ticker {
 	}()
 	return ticker
 }
+
+func startJobWorkers() {
+	// Number of uploads parsed concurrently in async mode
+	workers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil || workers < 1 {
+		workers = 1
+	}
+	services.JobService.Start(workers)
+}
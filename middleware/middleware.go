@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
+	"os"
 	"runtime/debug"
 
 	"github.com/gin-gonic/gin"
@@ -26,3 +28,20 @@ func RecoveryMiddleware() gin.HandlerFunc {
 		ctx.Next()
 	}
 }
+
+// AdminMiddleware only lets through requests whose X-Admin-Token header is
+// ADMIN_TOKEN. Admin routes are closed when ADMIN_TOKEN is not set.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin endpoints are disabled"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(ctx.GetHeader("X-Admin-Token")), []byte(token)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin token"})
+			return
+		}
+		ctx.Next()
+	}
+}
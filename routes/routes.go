@@ -2,6 +2,7 @@ package routes
 
 import (
 	"stockbackend/controllers"
+	"stockbackend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,6 +13,13 @@ func Routes(r *gin.Engine) {
 
 	{
 		v1.POST("/uploadXlsx", controllers.FileController.ParseXLSXFile)
+		v1.GET("/jobs/:id", controllers.JobController.GetJob)
+		v1.GET("/jobs/:id/result", controllers.JobController.GetJobResult)
+		v1.GET("/portfolios", controllers.PortfolioController.ListPortfolios)
+		v1.GET("/portfolios/:id", controllers.PortfolioController.GetPortfolio)
+		v1.GET("/portfolios/:id/changes", controllers.PortfolioController.GetPortfolioChanges)
+		v1.POST("/portfolioChanges", controllers.PortfolioController.CompareUploads)
+		v1.GET("/securities/:isin", controllers.SecurityMasterController.GetSecurity)
 		v1.POST("/mutualFundSimilarity", controllers.MFCompartorController.ParseMFSheets)
 		v1.GET("/keepServerRunning", controllers.HealthController.IsRunning)
 		v1.POST("/fetchGmail", controllers.GmailController.GetEmails)
@@ -19,4 +27,12 @@ func Routes(r *gin.Engine) {
 		v1.GET("/investmentRecommendation", controllers.StockController.GetInvestmentRecommendation)
 		v1.GET("/fetchStocksWithRecommendations", controllers.StockController.GetStocksWithRecommendations)
 	}
+
+	admin := v1.Group("/admin", middleware.AdminMiddleware())
+	{
+		admin.GET("/aliases", controllers.AliasController.ListAliases)
+		admin.POST("/aliases", controllers.AliasController.AddAlias)
+		admin.POST("/aliases/:id/confirm", controllers.AliasController.ConfirmAlias)
+		admin.POST("/securities/import", controllers.SecurityMasterController.ImportSecurities)
+	}
 }
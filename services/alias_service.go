@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	mongo_client "stockbackend/clients/mongo"
+	"stockbackend/types"
+	"stockbackend/utils/names"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	// ErrAliasNotFound is returned when no alias has the given id
+	ErrAliasNotFound = errors.New("alias not found")
+	// ErrCompanyNotFound is returned when an alias names an unknown company
+	ErrCompanyNotFound = errors.New("company not found")
+	// ErrInvalidAlias is returned for aliases that normalize to nothing
+	ErrInvalidAlias = errors.New("invalid alias")
+)
+
+// Alias sources
+const (
+	AliasSourceSeed    = "seed"
+	AliasSourceLearned = "learned"
+	AliasSourceAdmin   = "admin"
+)
+
+// seedAliases are disclosure names the company database lists under
+// names too different for the matcher. They are added, confirmed, the
+// first time the alias collection is used.
+var seedAliases = map[string]string{
+	"Sun Pharmaceutical Industries Limited":       "Sun Pharma.Inds.",
+	"KEC International Limited":                   "K E C Intl.",
+	"Sandhar Technologies Limited":                "Sandhar Tech",
+	"Samvardhana Motherson International Limited": "Samvardh. Mothe.",
+	"Coromandel International Limited":            "Coromandel Inter",
+}
+
+// AliasFilter selects aliases to list. A nil Confirmed lists all of them.
+type AliasFilter struct {
+	Confirmed *bool
+	Page      int
+	PageSize  int
+}
+
+type AliasServiceI interface {
+	Find(ctx context.Context, companyNames []string) (map[string]types.CompanyAlias, error)
+	Learn(ctx context.Context, alias string, companyID interface{}, companyName string, confidence float64)
+	Add(ctx context.Context, alias, companyID string) (types.CompanyAlias, error)
+	Confirm(ctx context.Context, id string) (types.CompanyAlias, error)
+	List(ctx context.Context, filter AliasFilter) ([]types.CompanyAlias, error)
+}
+
+type aliasService struct {
+	setupOnce sync.Once
+}
+
+var AliasService AliasServiceI = &aliasService{}
+
+// collection returns the alias collection, indexing it by key and adding
+// the seed aliases on first use
+func (as *aliasService) collection() *mongo.Collection {
+	name := os.Getenv("ALIAS_COLLECTION")
+	if name == "" {
+		name = "company_aliases"
+	}
+	collection := mongo_client.Client.Database(os.Getenv("DATABASE")).Collection(name)
+	as.setupOnce.Do(func() {
+		ctx := context.Background()
+		_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.M{"key": 1},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			zap.L().Error("Error creating alias index", zap.Error(err))
+		}
+		now := time.Now()
+		for alias, companyName := range seedAliases {
+			_, err := collection.UpdateOne(ctx, bson.M{"key": names.Key(alias)}, bson.M{"$setOnInsert": bson.M{
+				"alias":       alias,
+				"companyName": companyName,
+				"confirmed":   true,
+				"source":      AliasSourceSeed,
+				"createdAt":   now,
+				"updatedAt":   now,
+			}}, options.Update().SetUpsert(true))
+			if err != nil {
+				zap.L().Error("Error seeding alias", zap.String("alias", alias), zap.Error(err))
+			}
+		}
+	})
+	return collection
+}
+
+func companies() *mongo.Collection {
+	return mongo_client.Client.Database(os.Getenv("DATABASE")).Collection(os.Getenv("COLLECTION"))
+}
+
+// Find returns the aliases of the names, keyed by names.Key
+func (as *aliasService) Find(ctx context.Context, companyNames []string) (map[string]types.CompanyAlias, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, name := range companyNames {
+		if key := names.Key(name); key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	found := make(map[string]types.CompanyAlias)
+	for start := 0; start < len(keys); start += lookupBatchSize {
+		cursor, err := as.collection().Find(ctx, bson.M{"key": bson.M{"$in": batch(keys, start)}})
+		if err != nil {
+			return found, err
+		}
+		var aliases []types.CompanyAlias
+		if err := cursor.All(ctx, &aliases); err != nil {
+			return found, err
+		}
+		for _, alias := range aliases {
+			found[alias.Key] = alias
+		}
+	}
+	return found, nil
+}
+
+// Learn records an unconfirmed alias found by the resolver with the
+// confidence of the match. Confirmed aliases with the same key are left
+// alone.
+func (as *aliasService) Learn(ctx context.Context, alias string, companyID interface{}, companyName string, confidence float64) {
+	key := names.Key(alias)
+	id, ok := companyID.(primitive.ObjectID)
+	if key == "" || !ok {
+		return
+	}
+	now := time.Now()
+	_, err := as.collection().UpdateOne(ctx,
+		bson.M{"key": key, "confirmed": bson.M{"$ne": true}},
+		bson.M{
+			"$set": bson.M{
+				"alias":       alias,
+				"companyId":   id,
+				"companyName": companyName,
+				"confirmed":   false,
+				"confidence":  confidence,
+				"source":      AliasSourceLearned,
+				"updatedAt":   now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true))
+	// A confirmed alias with this key makes the upsert collide; that is
+	// the point
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		zap.L().Error("Failed to learn company alias", zap.String("alias", alias), zap.Error(err))
+	}
+}
+
+// Add confirms that alias is a name of the company, replacing whatever
+// the alias pointed at before
+func (as *aliasService) Add(ctx context.Context, alias, companyID string) (types.CompanyAlias, error) {
+	alias = strings.TrimSpace(alias)
+	key := names.Key(alias)
+	if key == "" {
+		return types.CompanyAlias{}, ErrInvalidAlias
+	}
+	id, err := primitive.ObjectIDFromHex(companyID)
+	if err != nil {
+		return types.CompanyAlias{}, ErrCompanyNotFound
+	}
+	var company struct {
+		Name string `bson:"name"`
+	}
+	err = companies().FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{"name": 1})).Decode(&company)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.CompanyAlias{}, ErrCompanyNotFound
+	}
+	if err != nil {
+		return types.CompanyAlias{}, err
+	}
+
+	now := time.Now()
+	updateOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var saved types.CompanyAlias
+	err = as.collection().FindOneAndUpdate(ctx, bson.M{"key": key}, bson.M{
+		"$set": bson.M{
+			"alias":       alias,
+			"companyId":   id,
+			"companyName": company.Name,
+			"confirmed":   true,
+			"source":      AliasSourceAdmin,
+			"updatedAt":   now,
+		},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}, updateOptions).Decode(&saved)
+	return saved, err
+}
+
+// Confirm marks a learned alias as right, so the resolver never replaces it
+func (as *aliasService) Confirm(ctx context.Context, id string) (types.CompanyAlias, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return types.CompanyAlias{}, ErrAliasNotFound
+	}
+	updateOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var saved types.CompanyAlias
+	err = as.collection().FindOneAndUpdate(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{"confirmed": true, "updatedAt": time.Now()},
+	}, updateOptions).Decode(&saved)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.CompanyAlias{}, ErrAliasNotFound
+	}
+	return saved, err
+}
+
+// List returns aliases, most recently changed first
+func (as *aliasService) List(ctx context.Context, filter AliasFilter) ([]types.CompanyAlias, error) {
+	query := bson.M{}
+	if filter.Confirmed != nil {
+		query["confirmed"] = *filter.Confirmed
+	}
+	pageSize := filter.PageSize
+	if pageSize < 1 {
+		pageSize = defaultPortfolioPageSize
+	}
+	pageSize = min(pageSize, maxPortfolioPageSize)
+	page := max(filter.Page, 1)
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.M{"updatedAt": -1})
+	findOptions.SetLimit(int64(pageSize))
+	findOptions.SetSkip(int64(pageSize * (page - 1)))
+
+	cursor, err := as.collection().Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	aliases := []types.CompanyAlias{}
+	if err := cursor.All(ctx, &aliases); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
@@ -64,7 +64,7 @@ func UpdateCompanyData() {
 			zap.Any("_id", companyID))
 
 		// Fetch fresh company data
-		companyData, err := helpers.FetchCompanyData(url)
+		companyData, err := helpers.FetchCompanyData(context.Background(), url)
 		if err != nil {
 			zap.L().Error("Error fetching company data",
 				zap.String("company", companyName),
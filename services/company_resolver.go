@@ -0,0 +1,508 @@
+package services
+
+import (
+	"context"
+	"os"
+	mongo_client "stockbackend/clients/mongo"
+	"stockbackend/types"
+	"stockbackend/utils/helpers"
+	"stockbackend/utils/holdings"
+	"stockbackend/utils/names"
+	"stockbackend/utils/pool"
+	"stockbackend/utils/securitymaster"
+	"strings"
+	"sync"
+
+	"github.com/getsentry/sentry-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// exactMatchScore is the confidence of companies found by ISIN, the
+// security master or a confirmed alias
+const exactMatchScore = 1.0
+
+// lookupBatchSize caps the number of values in a single $in query
+const lookupBatchSize = 500
+
+// textSearchCandidates is how many text search hits are kept as
+// candidates for holdings that do not resolve
+const textSearchCandidates = 5
+
+// companyMatch is the company document a holding resolved to, with the
+// confidence of the match from 0 to 1. Matches by ISIN, the security master
+// or a confirmed alias are confirmed; name guesses, learned aliases
+// included, are not. When no document was found, doc is nil and reason
+// says why.
+type companyMatch struct {
+	doc        bson.M
+	score      float64
+	confirmed  bool
+	candidates []types.CompanyCandidate
+	reason     string
+}
+
+// companyResolver resolves the holdings of one request to company
+// documents. ISINs and known aliases are looked up with batched $in
+// queries, then ISINs the security master knows are matched by their
+// exchange codes. The leftovers get one text search each, and every answer
+// (including misses) is cached for the rest of the request. An offline
+// resolver only reads: it does not learn aliases or ISINs.
+type companyResolver struct {
+	collection *mongo.Collection
+	offline    bool
+
+	mu         sync.Mutex
+	byISIN     map[string]*companyMatch
+	byName     map[string]*companyMatch
+	securities map[string]types.Security
+}
+
+func newCompanyResolver(offline bool) *companyResolver {
+	collection := mongo_client.Client.Database(os.Getenv("DATABASE")).Collection(os.Getenv("COLLECTION"))
+	indexCompanies(collection)
+	return &companyResolver{
+		collection: collection,
+		offline:    offline,
+		byISIN:     make(map[string]*companyMatch),
+		byName:     make(map[string]*companyMatch),
+		securities: make(map[string]types.Security),
+	}
+}
+
+// fieldExchangeCode is the NSE symbol or BSE code a company's page is
+// listed under, kept on the company so the security master can find it
+// through an index
+const fieldExchangeCode = "exchangeCode"
+
+var companyIndexOnce sync.Once
+
+// indexCompanies indexes companies by exchange code and by name, the two
+// fields the security master looks them up by, and fills in the exchange
+// code of companies stored before it was kept. The backfill runs in the
+// background; until it is done those companies are found by name only.
+func indexCompanies(collection *mongo.Collection) {
+	companyIndexOnce.Do(func() {
+		_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+			{Keys: bson.M{fieldExchangeCode: 1}},
+			{Keys: bson.M{"name": 1}},
+		})
+		if err != nil {
+			zap.L().Error("Error creating company indexes", zap.Error(err))
+		}
+		go backfillExchangeCodes(collection)
+	})
+}
+
+// backfillExchangeCodes stores the exchange code of every company that has
+// a page URL but no code yet. Companies whose URL has no code get an empty
+// one, so they are not read again on the next start.
+func backfillExchangeCodes(collection *mongo.Collection) {
+	ctx := context.Background()
+	filter := bson.M{fieldExchangeCode: bson.M{"$exists": false}, "url": bson.M{"$exists": true}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"url": 1}))
+	if err != nil {
+		zap.L().Error("Error finding companies without an exchange code", zap.Error(err))
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var models []mongo.WriteModel
+	updated := 0
+	flush := func() {
+		if len(models) == 0 {
+			return
+		}
+		if _, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			zap.L().Error("Error storing exchange codes", zap.Error(err))
+		} else {
+			updated += len(models)
+		}
+		models = nil
+	}
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			zap.L().Error("Error decoding company", zap.Error(err))
+			continue
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc["_id"]}).
+			SetUpdate(bson.M{"$set": bson.M{fieldExchangeCode: exchangeCode(doc)}}))
+		if len(models) == lookupBatchSize {
+			flush()
+		}
+	}
+	flush()
+	if updated > 0 {
+		zap.L().Info("Stored company exchange codes", zap.Int("companies", updated))
+	}
+}
+
+// exchangeCode is the stored exchange code of a company, or else the one
+// in its page URL
+func exchangeCode(doc bson.M) string {
+	if code, _ := doc[fieldExchangeCode].(string); code != "" {
+		return code
+	}
+	url, _ := doc["url"].(string)
+	return securitymaster.CompanyCode(url)
+}
+
+func holdingKeys(stockDetail map[string]interface{}) (string, string) {
+	name, _ := stockDetail[holdings.FieldName].(string)
+	isin, _ := stockDetail[holdings.FieldISIN].(string)
+	return strings.TrimSpace(name), strings.ToUpper(strings.TrimSpace(isin))
+}
+
+// Lookup returns the cached match for a holding, or nil if it was never
+// looked up
+func (r *companyResolver) Lookup(stockDetail map[string]interface{}) *companyMatch {
+	name, isin := holdingKeys(stockDetail)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if match := r.byISIN[isin]; isin != "" && match != nil {
+		return match
+	}
+	return r.byName[names.Key(name)]
+}
+
+// Resolve looks up every holding that is not already cached
+func (r *companyResolver) Resolve(ctx context.Context, span *sentry.Span, stockDetails []map[string]interface{}, workers int) {
+	lookups := make([]securitymaster.Holding, len(stockDetails))
+	for i, stockDetail := range stockDetails {
+		lookups[i] = holdingLookup(stockDetail)
+	}
+	r.mu.Lock()
+	isins, holdingNames := securitymaster.Keys(lookups,
+		func(isin string) bool { return r.byISIN[isin] != nil },
+		func(key string) bool { _, cached := r.byName[key]; return cached })
+	r.mu.Unlock()
+
+	if len(holdingNames) == 0 && len(isins) == 0 {
+		return
+	}
+	seenName := make(map[string]bool, len(holdingNames))
+	for _, name := range holdingNames {
+		seenName[names.Key(name)] = true
+	}
+
+	dbSpan := sentry.StartSpan(span.Context(), "[DB] Find companies by ISIN/alias")
+	for start := 0; start < len(holdingNames) || start < len(isins); start += lookupBatchSize {
+		r.findExact(ctx, batch(isins, start), batch(holdingNames, start))
+	}
+	dbSpan.Finish()
+
+	dbSpan = sentry.StartSpan(span.Context(), "[DB] Find companies by security master")
+	r.findBySecurity(ctx, isins)
+	dbSpan.Finish()
+
+	// Anything still not found falls back to a text search, holdings with
+	// an unmatched ISIN included: see securitymaster.SearchName
+	var leftovers []map[string]interface{}
+	queued := make(map[string]bool)
+	for _, stockDetail := range stockDetails {
+		name, _ := holdingKeys(stockDetail)
+		key := names.Key(name)
+		if !seenName[key] || queued[key] {
+			continue
+		}
+		if match := r.Lookup(stockDetail); match != nil && match.doc != nil {
+			r.mu.Lock()
+			r.byName[key] = match
+			r.mu.Unlock()
+			continue
+		}
+		queued[key] = true
+		leftovers = append(leftovers, stockDetail)
+	}
+
+	dbSpan = sentry.StartSpan(span.Context(), "[DB] Text search companies")
+	defer dbSpan.Finish()
+	pool.Each(len(leftovers), workers,
+		func(index int) {
+			r.findByText(ctx, leftovers[index])
+		},
+		func(index int, value interface{}) {
+			recoverHolding(ctx, leftovers[index], value)
+			name, _ := holdingKeys(leftovers[index])
+			r.cache(names.Key(name), &companyMatch{reason: ReasonLookupFailed})
+		})
+}
+
+func batch(values []string, start int) []string {
+	if start >= len(values) {
+		return nil
+	}
+	return values[start:min(start+lookupBatchSize, len(values))]
+}
+
+// findExact fetches every company whose ISIN is in the batch, or that one
+// of the names is an alias of. Only confirmed aliases match exactly; a
+// learned alias scores the confidence it was learned with.
+func (r *companyResolver) findExact(ctx context.Context, isins, holdingNames []string) {
+	aliases, err := AliasService.Find(ctx, holdingNames)
+	if err != nil {
+		zap.L().Error("Error finding company aliases", zap.Error(err))
+		captureException(ctx, err)
+	}
+	aliasesByID := make(map[primitive.ObjectID][]types.CompanyAlias)
+	aliasesByName := make(map[string][]types.CompanyAlias)
+	var ids []primitive.ObjectID
+	var companyNames []string
+	for _, alias := range aliases {
+		if !alias.CompanyID.IsZero() {
+			aliasesByID[alias.CompanyID] = append(aliasesByID[alias.CompanyID], alias)
+			ids = append(ids, alias.CompanyID)
+		} else {
+			aliasesByName[alias.CompanyName] = append(aliasesByName[alias.CompanyName], alias)
+			companyNames = append(companyNames, alias.CompanyName)
+		}
+	}
+
+	// Aliases stored on the company documents themselves predate the
+	// alias collection and are still honoured
+	var or []bson.M
+	if len(holdingNames) > 0 {
+		or = append(or, bson.M{"aliases": bson.M{"$in": holdingNames}})
+	}
+	if len(isins) > 0 {
+		or = append(or, bson.M{"isin": bson.M{"$in": isins}})
+	}
+	if len(ids) > 0 {
+		or = append(or, bson.M{"_id": bson.M{"$in": ids}})
+	}
+	if len(companyNames) > 0 {
+		or = append(or, bson.M{"name": bson.M{"$in": companyNames}})
+	}
+	cursor, err := r.collection.Find(ctx, bson.M{"$or": or})
+	if err != nil {
+		zap.L().Error("Error finding companies by ISIN/alias", zap.Error(err))
+		captureException(ctx, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	wanted := make(map[string]bool, len(holdingNames))
+	for _, name := range holdingNames {
+		wanted[names.Key(name)] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			zap.L().Error("Error decoding company", zap.Error(err))
+			continue
+		}
+		match := &companyMatch{doc: doc, score: exactMatchScore, confirmed: true}
+		if isin, ok := doc["isin"].(string); ok && isin != "" {
+			r.byISIN[strings.ToUpper(isin)] = match
+		}
+		for _, alias := range helpers.ToStringArray(doc["aliases"]) {
+			if key := names.Key(alias); wanted[key] {
+				r.byName[key] = match
+			}
+		}
+		id, _ := doc["_id"].(primitive.ObjectID)
+		name, _ := doc["name"].(string)
+		for _, alias := range append(aliasesByID[id], aliasesByName[name]...) {
+			if alias.Confirmed {
+				r.byName[alias.Key] = match
+				continue
+			}
+			r.byName[alias.Key] = &companyMatch{doc: doc, score: names.AliasConfidence(alias)}
+		}
+	}
+}
+
+// findBySecurity looks up the ISINs not matched so far in the security
+// master and finds their companies by the NSE symbol or BSE code in the
+// company page URL, or by the exchange's company name
+func (r *companyResolver) findBySecurity(ctx context.Context, isins []string) {
+	var missing []string
+	r.mu.Lock()
+	for _, isin := range isins {
+		if r.byISIN[isin] == nil {
+			missing = append(missing, isin)
+		}
+	}
+	r.mu.Unlock()
+	if len(missing) == 0 {
+		return
+	}
+
+	securities, err := SecurityMasterService.ByISIN(ctx, missing)
+	if err != nil {
+		zap.L().Error("Error looking up security master", zap.Error(err))
+		captureException(ctx, err)
+	}
+	if len(securities) == 0 {
+		return
+	}
+
+	byCode := make(map[string]string)
+	byNameKey := make(map[string]string)
+	var codes []string
+	var officialNames []string
+	for isin, security := range securities {
+		for _, code := range securitymaster.Codes(security) {
+			byCode[code] = isin
+			codes = append(codes, code)
+		}
+		byNameKey[security.NameKey] = isin
+		officialNames = append(officialNames, security.Name)
+	}
+	r.mu.Lock()
+	for isin, security := range securities {
+		r.securities[isin] = security
+	}
+	r.mu.Unlock()
+
+	for start := 0; start < len(codes) || start < len(officialNames); start += lookupBatchSize {
+		var or []bson.M
+		if codeBatch := batch(codes, start); len(codeBatch) > 0 {
+			or = append(or, bson.M{fieldExchangeCode: bson.M{"$in": codeBatch}})
+		}
+		if nameBatch := batch(officialNames, start); len(nameBatch) > 0 {
+			or = append(or, bson.M{"name": bson.M{"$in": nameBatch}})
+		}
+		cursor, err := r.collection.Find(ctx, bson.M{"$or": or})
+		if err != nil {
+			zap.L().Error("Error finding companies by exchange code", zap.Error(err))
+			captureException(ctx, err)
+			return
+		}
+		var docs []bson.M
+		if err := cursor.All(ctx, &docs); err != nil {
+			zap.L().Error("Error decoding companies", zap.Error(err))
+			continue
+		}
+
+		for _, doc := range docs {
+			isin, ok := byCode[exchangeCode(doc)]
+			if !ok {
+				name, _ := doc["name"].(string)
+				if isin, ok = byNameKey[names.Key(name)]; !ok {
+					continue
+				}
+			}
+			r.mu.Lock()
+			if r.byISIN[isin] != nil {
+				r.mu.Unlock()
+				continue
+			}
+			r.byISIN[isin] = &companyMatch{doc: doc, score: exactMatchScore, confirmed: true}
+			r.mu.Unlock()
+			r.remember(ctx, doc, securities[isin].Name, exactMatchScore)
+			r.rememberISIN(ctx, doc, isin)
+		}
+	}
+}
+
+// searchName is the name a holding is text searched by
+func (r *companyResolver) searchName(stockDetail map[string]interface{}) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return securitymaster.SearchName(holdingLookup(stockDetail), r.securities)
+}
+
+func holdingLookup(stockDetail map[string]interface{}) securitymaster.Holding {
+	name, isin := holdingKeys(stockDetail)
+	return securitymaster.Holding{Name: name, ISIN: isin}
+}
+
+// findByText runs the text search for one holding and caches the hit most
+// like its name, keeping all hits as candidates. Confident hits are learned
+// as unconfirmed aliases, so the next upload finds them with the batched
+// lookup. The holding's ISIN is not stored on a guess.
+func (r *companyResolver) findByText(ctx context.Context, stockDetail map[string]interface{}) {
+	name, isin := holdingKeys(stockDetail)
+	key := names.Key(name)
+	searchName := r.searchName(stockDetail)
+
+	// Prepare the text search filter
+	textSearchFilter := bson.M{
+		"$text": bson.M{
+			"$search": names.SearchQuery(searchName),
+		},
+	}
+	// Set find options
+	findOptions := options.Find()
+	findOptions.SetProjection(bson.M{
+		"score": bson.M{"$meta": "textScore"},
+	})
+	findOptions.SetSort(bson.M{
+		"score": bson.M{"$meta": "textScore"},
+	})
+	findOptions.SetLimit(textSearchCandidates)
+
+	var results []bson.M
+	cursor, err := r.collection.Find(ctx, textSearchFilter, findOptions)
+	if err == nil {
+		err = cursor.All(ctx, &results)
+	}
+	if err != nil {
+		zap.L().Error("Error finding document", zap.String("company", name), zap.Error(err))
+		captureException(ctx, err)
+		r.cache(key, &companyMatch{reason: ReasonLookupFailed})
+		return
+	}
+	if len(results) == 0 {
+		zap.L().Info("No company matches holding", zap.String("company", name))
+		r.cache(key, &companyMatch{reason: ReasonNoMatch})
+		return
+	}
+
+	match := &companyMatch{}
+	resultNames := make([]string, len(results))
+	for i, doc := range results {
+		resultNames[i], _ = doc["name"].(string)
+		url, _ := doc["url"].(string)
+		match.candidates = append(match.candidates, types.CompanyCandidate{Name: resultNames[i], URL: url})
+	}
+	best, confidence := names.Best(searchName, resultNames)
+	match.doc, match.score = results[best], confidence
+	r.cache(key, match)
+	if confidence < names.Confident {
+		return
+	}
+	if isin != "" {
+		r.mu.Lock()
+		r.byISIN[isin] = match
+		r.mu.Unlock()
+	}
+	r.remember(ctx, match.doc, name, confidence)
+}
+
+func (r *companyResolver) cache(key string, match *companyMatch) {
+	r.mu.Lock()
+	r.byName[key] = match
+	r.mu.Unlock()
+}
+
+// remember learns the disclosure name as an alias of the company, with the
+// confidence of the match
+func (r *companyResolver) remember(ctx context.Context, doc bson.M, name string, confidence float64) {
+	if r.offline {
+		return
+	}
+	companyName, _ := doc["name"].(string)
+	AliasService.Learn(ctx, name, doc["_id"], companyName, confidence)
+}
+
+// rememberISIN stores the ISIN on a company the security master matched it
+// to, unless the company already has one
+func (r *companyResolver) rememberISIN(ctx context.Context, doc bson.M, isin string) {
+	if r.offline || isin == "" {
+		return
+	}
+	filter := bson.M{"_id": doc["_id"], "isin": bson.M{"$exists": false}}
+	if _, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"isin": isin}}); err != nil {
+		zap.L().Error("Failed to remember company ISIN", zap.String("isin", isin), zap.Error(err))
+	}
+}
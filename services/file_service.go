@@ -2,330 +2,738 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
 	"stockbackend/clients/http_client"
-	mongo_client "stockbackend/clients/mongo"
-	"stockbackend/utils/constants"
+	"stockbackend/types"
+	"stockbackend/utils/events"
 	"stockbackend/utils/helpers"
+	"stockbackend/utils/holdings"
+	"stockbackend/utils/names"
+	"stockbackend/utils/pool"
+	"stockbackend/utils/securitymaster"
+	"stockbackend/utils/sheets"
+	"stockbackend/utils/storage"
+	"strconv"
 	"strings"
 
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 	"github.com/getsentry/sentry-go"
-	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"github.com/xuri/excelize/v2"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	"gopkg.in/mgo.v2/bson"
 )
 
+// ParseOptions tunes a single ParseXLSXFile run
+type ParseOptions struct {
+	// Progress is called after every holding with the number of holdings
+	// processed so far and the number found so far.
+	Progress func(done, total int)
+	// Workers is how many holdings are looked up and scored at once.
+	// Zero uses PARSE_WORKERS.
+	Workers int
+	// Schemes limits a multi-scheme workbook to the sheets it matches.
+	// Sheets that are not picked are neither scored nor stored.
+	Schemes holdings.SchemeFilter
+	// Offline only uses companies already in the database. Nothing is
+	// scraped, Gemini is not asked about sheets or funds the header
+	// profiles cannot read, and nothing is written: no archived upload,
+	// stored portfolio, learned alias or ISIN. Holdings without a
+	// confident match are reported as unresolved instead.
+	Offline bool
+}
+
+func (o ParseOptions) reportProgress(done, total int) {
+	if o.Progress != nil {
+		o.Progress(done, total)
+	}
+}
+
+func (o ParseOptions) workers() int {
+	if o.Workers > 0 {
+		return o.Workers
+	}
+	return envInt("PARSE_WORKERS", 8)
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 1 {
+		return fallback
+	}
+	return value
+}
+
+// captureException reports err to Sentry unless ctx has been cancelled:
+// lookups that fail because the client went away are not failures
+func captureException(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	sentry.CaptureException(err)
+}
+
+// Reasons a holding is unresolved
+const (
+	ReasonNoMatch         = "no_match"
+	ReasonLookupFailed    = "lookup_failed"
+	ReasonNoSearchResults = "no_search_results"
+	ReasonFetchFailed     = "fetch_failed"
+	ReasonLowConfidence   = "low_confidence"
+	ReasonNotScraped      = "not_scraped"
+	ReasonScoringFailed   = "scoring_failed"
+)
+
+// Codes of the warnings streamed while reading uploads
+const (
+	WarningUnreadableFile  = "unreadable_file"
+	WarningUnreadableSheet = "unreadable_sheet"
+	WarningSkippedSheet    = "skipped_sheet"
+)
+
+// maxCandidates caps the candidates listed on an unresolved holding
+const maxCandidates = 3
+
+// FundInfoSourceLLM marks fund details that were extracted by Gemini
+const FundInfoSourceLLM = "llm"
+
+// scrapeSlots caps how many company pages are scraped at once across all
+// uploads, however many parse workers are running.
+var scrapeSlots = make(chan struct{}, envInt("SCRAPE_CONCURRENCY", 2))
+
 type FileServiceI interface {
-	ParseXLSXFile(ctx *gin.Context, files <-chan string, sentryCtx context.Context) error
+	ParseXLSXFile(ctx context.Context, stream *events.Stream, files <-chan string, opts ParseOptions, sentryCtx context.Context) error
+	ExtractPortfolios(ctx context.Context, filePath string, sentryCtx context.Context) ([]types.Portfolio, error)
 }
 
 type fileService struct{}
 
 var FileService FileServiceI = &fileService{}
 
-func (fs *fileService) ParseXLSXFile(ctx *gin.Context, files <-chan string, sentryCtx context.Context) error {
+func (fs *fileService) ParseXLSXFile(ctx context.Context, stream *events.Stream, files <-chan string, opts ParseOptions, sentryCtx context.Context) error {
 	defer sentry.Recover()
 	span := sentry.StartSpan(sentryCtx, "[DAO] ParseXLSXFile")
 	defer span.Finish()
 
-	cld, err := cloudinary.NewFromURL(os.Getenv("CLOUDINARY_URL"))
-	if err != nil {
-		sentry.CaptureException(err)
-		span.Status = sentry.SpanStatusInternalError
-		return fmt.Errorf("error initializing Cloudinary: %w", err)
+	var store storage.Store = storage.Noop{}
+	if !opts.Offline {
+		store = archiveStore()
 	}
+	profiles := headerProfiles()
+	resolver := newCompanyResolver(opts.Offline)
+	done, total := 0, 0
 	for filePath := range files {
-		file, err := os.Open(filePath)
-		if err != nil {
-			sentry.CaptureException(err)
-			zap.L().Error("Error opening file", zap.String("filePath", filePath), zap.Error(err))
-			if err := os.Remove(filePath); err != nil {
-				zap.L().Error("Error removing file", zap.String("filePath", filePath), zap.Error(err))
-			} else {
-				zap.L().Info("File removed successfully", zap.String("filePath", filePath))
-			}
+		// Once the client has gone the remaining files are only removed
+		if stream.Err() != nil || ctx.Err() != nil {
+			removeFile(filePath)
 			continue
 		}
-		defer file.Close()
-
-		// Generate a UUID for the filename
-		uuid := uuid.New().String()
-		cloudinaryFilename := uuid + ".xlsx"
-		dbSpan1 := sentry.StartSpan(span.Context(), "[DB] Upload XLSX File")
-		// Upload file to Cloudinary
-		uploadResult, err := cld.Upload.Upload(ctx, file, uploader.UploadParams{
-			PublicID: cloudinaryFilename,
-			Folder:   "xlsx_uploads",
-		})
-		dbSpan1.Finish()
-		if err != nil {
-			zap.L().Error("Error uploading file to Cloudinary", zap.String("filePath", filePath), zap.Error(err))
-			sentry.CaptureException(err)
-			continue
+		var archive *types.ArchivedFile
+		if !opts.Offline {
+			archive = archiveUpload(ctx, span, store, filePath)
+		}
+		// Offline, Gemini is not asked about anything
+		sheets, warnings := readHoldings(ctx, span, profiles, readOptions{schemes: opts.Schemes, llmHoldings: !opts.Offline, llmFundInfo: !opts.Offline}, filePath)
+		for _, warning := range warnings {
+			stream.Warning(warning)
 		}
+		for _, sheet := range sheets {
+			total += len(sheet.holdings)
+		}
+		opts.reportProgress(done, total)
 
-		zap.L().Info("File uploaded to Cloudinary", zap.String("filePath", filePath), zap.String("url", uploadResult.SecureURL))
+		for _, sheet := range sheets {
+			if err := stream.Progress(events.Progress{Done: done, Total: total, File: filepath.Base(filePath), Sheet: sheet.name}); err != nil {
+				break
+			}
+			resolver.Resolve(ctx, span, equityHoldings(sheet.holdings), opts.workers())
+			err := fs.scoreHoldings(ctx, span, resolver, sheet.holdings, opts.workers(), func(stockDetail map[string]interface{}) error {
+				done++
+				opts.reportProgress(done, total)
+				return stream.Deliver(events.TypeRecord, stockDetail)
+			})
+			if err == nil {
+				summary := holdings.Summarize(sheet.holdings)
+				summary.Scheme = holdings.SchemeLabel(sheet.name, sheet.fund.SchemeName)
+				summary.Sheet = sheet.name
+				summary.Fund = sheet.fund
+				summary.HeaderProfile = sheet.profile
+				summary.Extraction = sheet.extraction
+				summary.Offline = opts.Offline
+				if !opts.Offline {
+					summary.PortfolioID = savePortfolio(ctx, span, filePath, archive, sheet, summary)
+				}
+				err = stream.Deliver(events.TypeSummary, summary)
+			}
+			if err != nil {
+				zap.L().Error("Stopped streaming file", zap.String("filePath", filePath), zap.Error(err))
+				break
+			}
+		}
+	}
 
-		// Create a new reader from the uploaded file
-		if _, err := file.Seek(0, 0); err != nil {
-			zap.L().Error("Error seeking file", zap.String("filePath", filePath), zap.Error(err))
-			sentry.CaptureException(err)
-			return err
+	// An abandoned request stops early without failing
+	if err := ctx.Err(); err != nil {
+		span.Status = sentry.SpanStatusCanceled
+		zap.L().Info("Upload cancelled", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// equityHoldings are the holdings that can be matched to a listed company
+func equityHoldings(all []map[string]interface{}) []map[string]interface{} {
+	var equities []map[string]interface{}
+	for _, stockDetail := range all {
+		if holdings.IsEquity(stockDetail) {
+			equities = append(equities, stockDetail)
 		}
+	}
+	return equities
+}
+
+// scoreHoldings enriches holdings on a pool of workers and passes each one
+// to onScored in its original sheet order. An error from onScored, or ctx
+// being cancelled, stops the remaining work and is returned.
+func (fs *fileService) scoreHoldings(ctx context.Context, span *sentry.Span, resolver *companyResolver, stockDetails []map[string]interface{}, workers int, onScored func(stockDetail map[string]interface{}) error) error {
+	return pool.Ordered(ctx, len(stockDetails), workers,
+		func(ctx context.Context, index int) {
+			fs.enrichHolding(ctx, span, resolver, stockDetails[index])
+		},
+		func(index int, value interface{}) {
+			recoverHolding(ctx, stockDetails[index], value)
+			markUnresolved(stockDetails[index], ReasonScoringFailed, nil)
+		},
+		func(index int) error {
+			return onScored(stockDetails[index])
+		})
+}
+
+// recoverHolding reports a panic while a holding was being looked up or
+// scored. The request carries on without it.
+func recoverHolding(ctx context.Context, stockDetail map[string]interface{}, value interface{}) {
+	instrumentName, _ := holdingKeys(stockDetail)
+	zap.L().Error("Panic processing holding", zap.String("company", instrumentName), zap.Any("panic", value), zap.String("stack", string(debug.Stack())))
+	sentry.CurrentHub().RecoverWithContext(ctx, value)
+}
+
+// savePortfolio stores the scored holdings of a sheet as a portfolio and
+// returns its ID. Sheets without a portfolio date are not stored since they
+// cannot be told apart from other months of the same scheme.
+func savePortfolio(ctx context.Context, span *sentry.Span, filePath string, archive *types.ArchivedFile, sheet sheetHoldings, summary types.PortfolioSummary) string {
+	if sheet.fund.AsOfDate == "" {
+		zap.L().Info("Not storing portfolio without a date", zap.String("sheet", sheet.name))
+		return ""
+	}
+	schemeName := sheet.fund.SchemeName
+	if schemeName == "" {
+		schemeName = sheet.name
+	}
+
+	dbSpan := sentry.StartSpan(span.Context(), "[DB] Save portfolio")
+	defer dbSpan.Finish()
+	portfolio, err := PortfolioService.Save(ctx, types.Portfolio{
+		SchemeName: schemeName,
+		AMC:        sheet.fund.AMC,
+		AsOfDate:   sheet.fund.AsOfDate,
+		Sheet:      sheet.name,
+		SourceFile: filepath.Base(filePath),
+		Summary:    summary,
+		Holdings:   holdings.PortfolioHoldings(sheet.holdings),
+		Archive:    archive,
+	})
+	if err != nil {
+		zap.L().Error("Error saving portfolio", zap.String("scheme", schemeName), zap.Error(err))
+		captureException(ctx, err)
+		return ""
+	}
+	return portfolio.ID.Hex()
+}
+
+// ExtractPortfolios reads the holdings of every sheet in a workbook without
+// scoring, archiving or storing them. The file is removed once read.
+func (fs *fileService) ExtractPortfolios(ctx context.Context, filePath string, sentryCtx context.Context) ([]types.Portfolio, error) {
+	span := sentry.StartSpan(sentryCtx, "[DAO] ExtractPortfolios")
+	defer span.Finish()
+
+	sheets, warnings := readHoldings(ctx, span, headerProfiles(), readOptions{llmHoldings: true, llmFundInfo: true}, filePath)
+	// A workbook that cannot be opened would otherwise look like one with
+	// no schemes
+	for _, warning := range warnings {
+		if warning.Code == WarningUnreadableFile {
+			return nil, errors.New(warning.Message)
+		}
+	}
+	portfolios := make([]types.Portfolio, 0, len(sheets))
+	for _, sheet := range sheets {
+		schemeName := sheet.fund.SchemeName
+		if schemeName == "" {
+			schemeName = sheet.name
+		}
+		portfolios = append(portfolios, types.Portfolio{
+			SchemeName: schemeName,
+			AMC:        sheet.fund.AMC,
+			AsOfDate:   sheet.fund.AsOfDate,
+			Sheet:      sheet.name,
+			SourceFile: filepath.Base(filePath),
+			Holdings:   holdings.PortfolioHoldings(sheet.holdings),
+		})
+	}
+	return portfolios, nil
+}
+
+// sheetHoldings are the holdings extracted from one sheet of a workbook
+type sheetHoldings struct {
+	name    string
+	fund    types.FundInfo
+	profile string
+	// extraction is holdings.ExtractionHeader or holdings.ExtractionLLM
+	extraction string
+	holdings   []map[string]interface{}
+}
+
+// headerProfiles loads the header profiles from HEADER_PROFILES_PATH on
+// every run, so AMCs can be added by editing the file. The built-in
+// profiles are used when the variable is unset or the file is invalid.
+func headerProfiles() *holdings.ProfileRegistry {
+	path := os.Getenv("HEADER_PROFILES_PATH")
+	if path == "" {
+		return holdings.DefaultProfiles()
+	}
+	profiles, err := holdings.LoadProfiles(path)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("Error loading header profiles, using defaults", zap.String("path", path), zap.Error(err))
+		return holdings.DefaultProfiles()
+	}
+	return profiles
+}
+
+// archiveStore returns the blob store chosen by STORAGE_BACKEND. A bad
+// configuration is logged and archiving skipped rather than failing the
+// upload, since nothing reads the archive back while parsing.
+func archiveStore() storage.Store {
+	store, err := storage.New(storage.ConfigFromEnv())
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("Error configuring upload storage, not archiving", zap.Error(err))
+		return storage.Noop{}
+	}
+	return store
+}
+
+// archiveUpload stores an uploaded workbook under the hash of its content
+// and returns where, or nil when archiving is off or fails
+func archiveUpload(ctx context.Context, span *sentry.Span, store storage.Store, filePath string) *types.ArchivedFile {
+	if store.Backend() == storage.BackendNone {
+		return nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		zap.L().Error("Error opening file", zap.String("filePath", filePath), zap.Error(err))
+		return nil
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		zap.L().Error("Error reading file size", zap.String("filePath", filePath), zap.Error(err))
+		return nil
+	}
+
+	key, sum, err := storage.ContentKey("uploads", filepath.Ext(filePath), file)
+	if err != nil {
+		zap.L().Error("Error hashing file", zap.String("filePath", filePath), zap.Error(err))
+		return nil
+	}
+	dbSpan := sentry.StartSpan(span.Context(), "[DB] Archive upload")
+	location, err := store.Put(ctx, key, file, info.Size())
+	dbSpan.Finish()
+	if err != nil {
+		zap.L().Error("Error archiving upload", zap.String("filePath", filePath), zap.String("backend", store.Backend()), zap.Error(err))
+		captureException(ctx, err)
+		return nil
+	}
+	zap.L().Info("Upload archived", zap.String("filePath", filePath), zap.String("key", key))
+	return &types.ArchivedFile{Backend: store.Backend(), Key: key, SHA256: sum, Location: location, Size: info.Size()}
+}
+
+// readOptions picks what readHoldings reads and when it asks Gemini
+type readOptions struct {
+	// schemes picks the sheets to read; nil reads them all
+	schemes holdings.SchemeFilter
+	// llmHoldings sends the sheets the header profiles cannot read to
+	// Gemini; otherwise they are skipped with a warning
+	llmHoldings bool
+	// llmFundInfo asks Gemini for a scheme name the title rows lack
+	llmFundInfo bool
+}
+
+// readHoldings extracts the holdings of each sheet picked by opts. Files
+// and sheets that cannot be read are returned as warnings. The file is
+// removed from disk once it has been read.
+func readHoldings(ctx context.Context, span *sentry.Span, profiles *holdings.ProfileRegistry, opts readOptions, filePath string) ([]sheetHoldings, []events.Notice) {
+	defer removeFile(filePath)
+
+	file := filepath.Base(filePath)
+	f, err := openWorkbook(filePath)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("Error opening workbook", zap.String("filePath", filePath), zap.Error(err))
+		return nil, []events.Notice{{Code: WarningUnreadableFile, Message: err.Error(), File: file}}
+	}
+	defer f.Close()
 
-		f, err := excelize.OpenReader(file)
-		if err != nil {
+	var found []sheetHoldings
+	var warnings []events.Notice
+	// Loop through the sheets and extract relevant information
+	for _, sheet := range f.Sheets() {
+		zap.L().Info("Processing file", zap.String("filePath", filePath), zap.String("format", f.Format()), zap.String("sheet", sheet))
+
+		// Stream the rows of the sheet instead of loading it whole
+		extractor := holdings.NewExtractorWithProfiles(profiles)
+		if err := eachRow(f, sheet, extractor.AddRow); err != nil {
 			sentry.CaptureException(err)
-			zap.L().Error("Error parsing XLSX file", zap.String("filePath", filePath), zap.Error(err))
-			if err := os.Remove(filePath); err != nil {
-				zap.L().Error("Error removing file", zap.String("filePath", filePath), zap.Error(err))
-			} else {
-				zap.L().Info("File removed successfully", zap.String("filePath", filePath))
-			}
+			zap.L().Error("Error reading rows from sheet", zap.String("sheet", sheet), zap.Error(err))
+			warnings = append(warnings, events.Notice{Code: WarningUnreadableSheet, Message: err.Error(), File: file, Sheet: sheet})
 			continue
 		}
-		defer f.Close()
-
-		// Get all the sheet names
-		sheetList := f.GetSheetList()
-		// Loop through the sheets and extract relevant information
-		for _, sheet := range sheetList {
-			zap.L().Info("Processing file", zap.String("filePath", filePath), zap.String("sheet", sheet))
 
-			// Get all the rows in the sheet
-			rows, err := f.GetRows(sheet)
-			if err != nil {
-				sentry.CaptureException(err)
-				zap.L().Error("Error reading rows from sheet", zap.String("sheet", sheet), zap.Error(err))
+		sheetData := sheetHoldings{name: sheet, profile: extractor.Profile(), extraction: holdings.ExtractionHeader, holdings: extractor.Holdings()}
+		if extractor.HeaderFound() {
+			if len(sheetData.holdings) == 0 {
 				continue
 			}
+			sheetData.fund = extractor.FundInfo()
+			if opts.llmFundInfo {
+				sheetData.fund = sheetFundInfo(span, extractor)
+			}
+			if !opts.schemes.Match(sheet, sheetData.fund.SchemeName) {
+				continue
+			}
+		} else {
+			// No known header: let the LLM read the holdings instead of
+			// skipping the sheet, unless the scheme was not asked for
+			if !opts.schemes.Match(sheet, extractor.FundInfo().SchemeName) {
+				continue
+			}
+			if !opts.llmHoldings {
+				zap.L().Info("Skipping sheet without a known header", zap.String("sheet", sheet))
+				warnings = append(warnings, events.Notice{Code: WarningSkippedSheet, Message: "no known holdings header", File: file, Sheet: sheet})
+				continue
+			}
+			sheetData.extraction = holdings.ExtractionLLM
+			sheetData.holdings, sheetData.fund = llmHoldings(span, f, sheet, extractor)
+			if len(sheetData.holdings) == 0 {
+				continue
+			}
+		}
+
+		zap.L().Info("Extracted holdings", zap.String("sheet", sheet), zap.String("extraction", sheetData.extraction), zap.Int("holdings", len(sheetData.holdings)))
+		scheme := holdings.SchemeLabel(sheet, sheetData.fund.SchemeName)
+		for _, stockDetail := range sheetData.holdings {
+			stockDetail["fund"] = sheetData.fund
+			stockDetail["scheme"] = scheme
+			stockDetail["sheet"] = sheet
+		}
+		found = append(found, sheetData)
+	}
+	return found, warnings
+}
 
-			headerFound := false
-			headerMap := make(map[string]int)
-			stopExtracting := false
+// removeFile deletes an upload once it is no longer needed
+func removeFile(filePath string) {
+	if err := os.Remove(filePath); err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("Error removing file", zap.String("filePath", filePath), zap.Error(err))
+	} else {
+		zap.L().Info("File removed successfully", zap.String("filePath", filePath))
+	}
+}
 
-			// Loop through the rows in the sheet
-			for _, row := range rows {
-				if len(row) == 0 {
-					continue
-				}
+// llmHoldings asks Gemini for the holdings of a sheet the header profiles
+// could not read. At most LLM_FALLBACK_MAX_ROWS rows are sent.
+func llmHoldings(span *sentry.Span, f sheets.Workbook, sheet string, extractor *holdings.Extractor) ([]map[string]interface{}, types.FundInfo) {
+	rows, err := collectRows(f, sheet)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("Error reading rows from sheet", zap.String("sheet", sheet), zap.Error(err))
+		return nil, types.FundInfo{}
+	}
+	var nonEmpty [][]string
+	for _, row := range rows {
+		if hasContent(row) {
+			nonEmpty = append(nonEmpty, row)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return nil, types.FundInfo{}
+	}
+	if maxRows := envInt("LLM_FALLBACK_MAX_ROWS", 500); len(nonEmpty) > maxRows {
+		nonEmpty = nonEmpty[:maxRows]
+	}
 
-				if !headerFound {
-					for _, cell := range row {
-						if helpers.MatchHeader(cell, []string{`name\s*of\s*(the)?\s*instrument`}) {
-							headerFound = true
-							// Build the header map
-							for i, headerCell := range row {
-								normalizedHeader := helpers.NormalizeString(headerCell)
-								// Map possible variations to standard keys
-								switch {
-								case helpers.MatchHeader(normalizedHeader, []string{`name\s*of\s*(the)?\s*instrument`}):
-									headerMap["Name of the Instrument"] = i
-								case helpers.MatchHeader(normalizedHeader, []string{`isin`}):
-									headerMap["ISIN"] = i
-								case helpers.MatchHeader(normalizedHeader, []string{`rating\s*/\s*industry`, `industry\s*/\s*rating`}):
-									headerMap["Industry/Rating"] = i
-								case helpers.MatchHeader(normalizedHeader, []string{`quantity`}):
-									headerMap["Quantity"] = i
-								case helpers.MatchHeader(normalizedHeader, []string{`market\s*/\s*fair\s*value.*`, `market\s*value.*`}):
-									headerMap["Market/Fair Value"] = i
-								case helpers.MatchHeader(normalizedHeader, []string{`%.*nav`, `%.*net\s*assets`}):
-									headerMap["Percentage of AUM"] = i
-								}
-							}
-							// zap.L().Info("Header found", zap.Any("headerMap", headerMap))
-							break
-						}
-					}
-					continue
-				}
+	llmSpan := sentry.StartSpan(span.Context(), "[LLM] Extract holdings")
+	mfData := CallGeminiAPI(nonEmpty)
+	llmSpan.Finish()
 
-				// Check for the end marker "Subtotal" or "Total"
-				joinedRow := strings.Join(row, "")
-				if strings.Contains(strings.ToLower(joinedRow), "subtotal") || strings.Contains(strings.ToLower(joinedRow), "total") {
-					stopExtracting = true
-					break
-				}
+	fund := extractor.FundInfo()
+	if fund.SchemeName == "" && mfData.MutualFundName != "" {
+		fund.SchemeName = mfData.MutualFundName
+		if fund.AMC == "" {
+			fund.AMC = holdings.AMCForScheme(fund.SchemeName)
+		}
+		fund.Source = FundInfoSourceLLM
+	}
+	return holdings.InstrumentHoldings(mfData.FundData), fund
+}
 
-				if !stopExtracting {
-					stockDetail := make(map[string]interface{})
-
-					// Extract data using the header map
-					for key, idx := range headerMap {
-						if idx < len(row) {
-							stockDetail[key] = row[idx]
-						} else {
-							stockDetail[key] = ""
-						}
-					}
-
-					// Check if the stockDetail has meaningful data
-					if stockDetail["Name of the Instrument"] == nil || stockDetail["Name of the Instrument"] == "" {
-						continue
-					}
-
-					// Additional processing
-					instrumentName, ok := stockDetail["Name of the Instrument"].(string)
-					if !ok {
-						continue
-					}
-
-					// Apply mapping if exists
-					if mappedName, exists := constants.MapValues[instrumentName]; exists {
-						stockDetail["Name of the Instrument"] = mappedName
-						instrumentName = mappedName
-					}
-
-					// Clean up the query string
-					queryString := instrumentName
-					queryString = strings.ReplaceAll(queryString, " Corporation ", " Corpn ")
-					queryString = strings.ReplaceAll(queryString, " corporation ", " Corpn ")
-					queryString = strings.ReplaceAll(queryString, " Limited", " Ltd ")
-					queryString = strings.ReplaceAll(queryString, " limited", " Ltd ")
-					queryString = strings.ReplaceAll(queryString, " and ", " & ")
-					queryString = strings.ReplaceAll(queryString, " And ", " & ")
-
-					// Prepare the text search filter
-					textSearchFilter := bson.M{
-						"$text": bson.M{
-							"$search": queryString,
-						},
-					}
-
-					// MongoDB collection
-					collection := mongo_client.Client.Database(os.Getenv("DATABASE")).Collection(os.Getenv("COLLECTION"))
-					// Set find options
-					findOptions := options.FindOne()
-					findOptions.SetProjection(bson.M{
-						"score": bson.M{"$meta": "textScore"},
-					})
-					findOptions.SetSort(bson.M{
-						"score": bson.M{"$meta": "textScore"},
-					})
-
-					// Perform the search
-					var result bson.M
-					dbSpan3 := sentry.StartSpan(span.Context(), "[DB] FindOne")
-					err = collection.FindOne(context.TODO(), textSearchFilter, findOptions).Decode(&result)
-					if err != nil {
-						zap.L().Error("Error finding document", zap.Error(err))
-						sentry.CaptureException(err)
-						continue
-					}
-					dbSpan3.Finish()
-
-					// Process based on the score
-					if score, ok := result["score"].(float64); ok {
-						if score >= 1 {
-							// zap.L().Info("marketCap", zap.Any("marketCap", result["marketCap"]), zap.Any("name", stockDetail["Name of the Instrument"]))
-							stockDetail["marketCapValue"] = result["marketCap"]
-							stockDetail["url"] = result["url"]
-							stockDetail["marketCap"] = helpers.GetMarketCapCategory(fmt.Sprintf("%v", result["marketCap"]))
-							peerComparisonScore, trendScore, finalScore := helpers.RateStock(result)
-							stockDetail["stockRate"] = finalScore
-							stockDetail["peerComparisonScore"] = peerComparisonScore
-							stockDetail["trendScore"] = trendScore
-
-							stockFScore, operatingEfficiencyScore, leverageScore, profitablityScore := helpers.GenerateFScore(result)
-							if stockFScore < 0 {
-								stockDetail["fScore"] = "Not Available"
-							} else {
-								stockDetail["fScore"] = stockFScore
-							}
-							stockDetail["operatingEfficiency"] = operatingEfficiencyScore
-							stockDetail["leverageScore"] = leverageScore
-							stockDetail["profitablityScore"] = profitablityScore
-						} else {
-							// zap.L().Info("score less than 1", zap.Float64("score", score))
-							dbSpan4 := sentry.StartSpan(span.Context(), "[DB] SearchCompany")
-							results, err := http_client.SearchCompany(instrumentName)
-							if err != nil || len(results) == 0 {
-								zap.L().Error("No company found", zap.Error(err))
-								sentry.CaptureException(err)
-								continue
-							}
-							dbSpan4.Finish()
-							dbSpan5 := sentry.StartSpan(span.Context(), "[DB] FetchCompanyData")
-							data, err := helpers.FetchCompanyData(results[0].URL)
-							dbSpan5.Finish()
-							if err != nil {
-								zap.L().Error("Error fetching company data", zap.Error(err))
-								sentry.CaptureException(err)
-								continue
-							}
-							// Update MongoDB with fetched data
-							update := bson.M{
-								"$set": bson.M{
-									"marketCap":           data["Market Cap"],
-									"currentPrice":        data["Current Price"],
-									"highLow":             data["High / Low"],
-									"stockPE":             data["Stock P/E"],
-									"bookValue":           data["Book Value"],
-									"dividendYield":       data["Dividend Yield"],
-									"roce":                data["ROCE"],
-									"roe":                 data["ROE"],
-									"faceValue":           data["Face Value"],
-									"pros":                data["pros"],
-									"cons":                data["cons"],
-									"quarterlyResults":    data["quarterlyResults"],
-									"profitLoss":          data["profitLoss"],
-									"balanceSheet":        data["balanceSheet"],
-									"cashFlows":           data["cashFlows"],
-									"ratios":              data["ratios"],
-									"shareholdingPattern": data["shareholdingPattern"],
-									"peersTable":          data["peersTable"],
-									"peers":               data["peers"],
-								},
-							}
-							dbSpan6 := sentry.StartSpan(span.Context(), "[DB] UpdateOne")
-							updateOptions := options.Update().SetUpsert(true)
-							filter := bson.M{"name": results[0].Name}
-							_, err = collection.UpdateOne(context.TODO(), filter, update, updateOptions)
-							dbSpan6.Finish()
-							if err != nil {
-								zap.L().Error("Failed to update document", zap.Error(err))
-								sentry.CaptureException(err)
-							} else {
-								zap.L().Info("Successfully updated document", zap.String("company", results[0].Name))
-							}
-						}
-					} else {
-						zap.L().Error("No score available for", zap.String("company", instrumentName))
-					}
-
-					// Marshal and write the stockDetail
-					stockDataMarshal, err := json.Marshal(stockDetail)
-					if err != nil {
-						zap.L().Error("Error marshalling data", zap.Error(err))
-						sentry.CaptureException(err)
-						continue
-					}
-
-					_, err = ctx.Writer.Write(append(stockDataMarshal, '\n')) // Send each stockDetail as JSON with a newline separator
-
-					if err != nil {
-						sentry.CaptureException(err)
-						zap.L().Error("Error writing data", zap.Error(err))
-						break
-					}
-					ctx.Writer.Flush() // Flush each chunk immediately
-				}
-			}
+func hasContent(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return true
 		}
-		if err := os.Remove(filePath); err != nil {
-			sentry.CaptureException(err)
-			zap.L().Error("Error removing file", zap.String("filePath", filePath), zap.Error(err))
+	}
+	return false
+}
+
+// sheetFundInfo reads the scheme name, AMC and date from the sheet's title
+// rows, asking the LLM only when no scheme name could be found there
+func sheetFundInfo(span *sentry.Span, extractor *holdings.Extractor) types.FundInfo {
+	fund := extractor.FundInfo()
+	if fund.SchemeName != "" {
+		return fund
+	}
+
+	llmSpan := sentry.StartSpan(span.Context(), "[LLM] Fund info")
+	llmFund := CallGeminiFundInfo(extractor.TitleRows())
+	llmSpan.Finish()
+	if llmFund.SchemeName == "" {
+		return fund
+	}
+	fund.SchemeName = llmFund.SchemeName
+	if fund.AMC == "" {
+		fund.AMC = llmFund.AMC
+	}
+	if fund.AsOfDate == "" {
+		fund.AsOfDate = llmFund.AsOfDate
+	}
+	fund.Source = FundInfoSourceLLM
+	return fund
+}
+
+// enrichHolding adds the market cap and scores of the company an equity
+// holding resolved to, scraping and upserting the company when the match is
+// not confident, unless the resolver is offline. Equity holdings that
+// cannot be matched are marked unresolved with the reason and the closest
+// candidates. Other asset classes are left as they are.
+func (fs *fileService) enrichHolding(ctx context.Context, span *sentry.Span, resolver *companyResolver, stockDetail map[string]interface{}) {
+	if !holdings.IsEquity(stockDetail) {
+		return
+	}
+	instrumentName, _ := holdingKeys(stockDetail)
+	match := resolver.Lookup(stockDetail)
+	if match == nil || match.doc == nil {
+		reason := ReasonNoMatch
+		if match != nil {
+			reason = match.reason
+		}
+		markUnresolved(stockDetail, reason, nil)
+		return
+	}
+
+	result, score := match.doc, match.score
+	if score >= names.Confident {
+		stockDetail["marketCapValue"] = result["marketCap"]
+		stockDetail["url"] = result["url"]
+		stockDetail[holdings.FieldMarketCap] = helpers.GetMarketCapCategory(fmt.Sprintf("%v", result["marketCap"]))
+		peerComparisonScore, trendScore, finalScore := helpers.RateStock(result)
+		stockDetail[holdings.FieldStockRate] = finalScore
+		stockDetail["peerComparisonScore"] = peerComparisonScore
+		stockDetail["trendScore"] = trendScore
+
+		stockFScore, operatingEfficiencyScore, leverageScore, profitablityScore := helpers.GenerateFScore(result)
+		if stockFScore < 0 {
+			stockDetail[holdings.FieldFScore] = "Not Available"
 		} else {
-			zap.L().Info("File removed successfully", zap.String("filePath", filePath))
+			stockDetail[holdings.FieldFScore] = stockFScore
 		}
+		stockDetail["operatingEfficiency"] = operatingEfficiencyScore
+		stockDetail["leverageScore"] = leverageScore
+		stockDetail["profitablityScore"] = profitablityScore
+		// Only companies whose recommendation has been worked out carry
+		// a valuation
+		for _, field := range []string{"recommendation", "targetPrice", "currentPrice", "upsideDownside"} {
+			if value, ok := result[field]; ok && value != nil {
+				stockDetail[field] = value
+			}
+		}
+		stockDetail[holdings.FieldCompanyID] = result["_id"]
+		stockDetail[holdings.FieldStatus] = holdings.StatusResolved
+		stockDetail[holdings.FieldMatchConfidence] = score
+		stockDetail[holdings.FieldMatchConfirmed] = match.confirmed
+		return
+	}
+	if resolver.offline {
+		markUnresolved(stockDetail, ReasonNotScraped, append([]types.CompanyCandidate{}, match.candidates...))
+		return
 	}
 
-	return nil
+	results, confidence, data, err := scrapeCompany(ctx, span, resolver.searchName(stockDetail))
+	if ctx.Err() != nil {
+		// The request was abandoned: nothing will read this holding
+		return
+	}
+	if err != nil {
+		reason := ReasonFetchFailed
+		switch {
+		case len(results) == 0:
+			reason = ReasonNoSearchResults
+		case errors.Is(err, errLowConfidence):
+			reason = ReasonLowConfidence
+		}
+		// match is shared with other holdings of the same name, so copy
+		candidates := append([]types.CompanyCandidate{}, match.candidates...)
+		for _, result := range results {
+			candidates = append(candidates, types.CompanyCandidate{Name: result.Name, URL: result.URL})
+		}
+		markUnresolved(stockDetail, reason, candidates)
+		return
+	}
+	company := results[0]
+	// Update MongoDB with fetched data
+	update := bson.M{
+		"$set": bson.M{
+			"marketCap":           data["Market Cap"],
+			"currentPrice":        data["Current Price"],
+			"highLow":             data["High / Low"],
+			"stockPE":             data["Stock P/E"],
+			"bookValue":           data["Book Value"],
+			"dividendYield":       data["Dividend Yield"],
+			"roce":                data["ROCE"],
+			"roe":                 data["ROE"],
+			"faceValue":           data["Face Value"],
+			"pros":                data["pros"],
+			"cons":                data["cons"],
+			"quarterlyResults":    data["quarterlyResults"],
+			"profitLoss":          data["profitLoss"],
+			"balanceSheet":        data["balanceSheet"],
+			"cashFlows":           data["cashFlows"],
+			"ratios":              data["ratios"],
+			"shareholdingPattern": data["shareholdingPattern"],
+			"peersTable":          data["peersTable"],
+			"peers":               data["peers"],
+		},
+	}
+	if code := securitymaster.CompanyCode(company.URL); code != "" {
+		update["$set"].(bson.M)[fieldExchangeCode] = code
+	}
+	dbSpan6 := sentry.StartSpan(span.Context(), "[DB] FindOneAndUpdate")
+	updateOptions := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"_id": 1})
+	filter := bson.M{"name": company.Name}
+	var updated bson.M
+	err = resolver.collection.FindOneAndUpdate(ctx, filter, update, updateOptions).Decode(&updated)
+	dbSpan6.Finish()
+	if err != nil {
+		zap.L().Error("Failed to update document", zap.Error(err))
+		captureException(ctx, err)
+	} else {
+		zap.L().Info("Successfully updated document", zap.String("company", company.Name))
+		stockDetail[holdings.FieldCompanyID] = updated["_id"]
+		AliasService.Learn(ctx, instrumentName, updated["_id"], company.Name, confidence)
+	}
+	stockDetail["url"] = company.URL
+	stockDetail[holdings.FieldStatus] = holdings.StatusResolved
+	stockDetail[holdings.FieldMatchConfidence] = confidence
+	stockDetail[holdings.FieldMatchConfirmed] = false
+}
+
+// markUnresolved records why a holding did not resolve and the companies
+// it most resembles
+func markUnresolved(stockDetail map[string]interface{}, reason string, candidates []types.CompanyCandidate) {
+	instrumentName, _ := holdingKeys(stockDetail)
+	stockDetail[holdings.FieldStatus] = holdings.StatusUnresolved
+	stockDetail["reason"] = reason
+	stockDetail["candidates"] = rankCandidates(instrumentName, candidates)
+}
+
+// rankCandidates scores candidates by name similarity to the holding and
+// returns the best maxCandidates of them, without duplicates
+func rankCandidates(instrumentName string, candidates []types.CompanyCandidate) []types.CompanyCandidate {
+	ranked := []types.CompanyCandidate{}
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		key := names.Key(candidate.Name)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidate.Similarity = names.Similarity(instrumentName, candidate.Name)
+		ranked = append(ranked, candidate)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Similarity > ranked[j].Similarity
+	})
+	if len(ranked) > maxCandidates {
+		ranked = ranked[:maxCandidates]
+	}
+	return ranked
+}
+
+// errLowConfidence is returned by scrapeCompany when no search result is
+// plausibly the company searched for
+var errLowConfidence = errors.New("no plausible search result")
+
+// scrapeCompany searches for the company by name and fetches the page of
+// the result most like the name. It waits for a free scrape slot first,
+// and gives up if ctx is cancelled. The search results are returned, best
+// first, even when none is plausible or fetching the page fails.
+func scrapeCompany(ctx context.Context, span *sentry.Span, instrumentName string) ([]types.Company, float64, map[string]interface{}, error) {
+	select {
+	case scrapeSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, 0, nil, ctx.Err()
+	}
+	defer func() { <-scrapeSlots }()
+
+	dbSpan4 := sentry.StartSpan(span.Context(), "[DB] SearchCompany")
+	results, err := http_client.SearchCompany(ctx, names.SearchQuery(instrumentName))
+	dbSpan4.Finish()
+	if err != nil || len(results) == 0 {
+		zap.L().Error("No company found", zap.Error(err))
+		captureException(ctx, err)
+		if err == nil {
+			err = fmt.Errorf("no company found for %q", instrumentName)
+		}
+		return nil, 0, nil, err
+	}
+
+	resultNames := make([]string, len(results))
+	for i, result := range results {
+		resultNames[i] = result.Name
+	}
+	best, confidence := names.Best(instrumentName, resultNames)
+	results[0], results[best] = results[best], results[0]
+	if confidence < names.Plausible {
+		zap.L().Info("No plausible search result", zap.String("company", instrumentName), zap.Float64("confidence", confidence))
+		return results, confidence, nil, errLowConfidence
+	}
+
+	dbSpan5 := sentry.StartSpan(span.Context(), "[DB] FetchCompanyData")
+	data, err := helpers.FetchCompanyData(ctx, results[0].URL)
+	dbSpan5.Finish()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		zap.L().Error("Error fetching company data", zap.Error(err))
+		captureException(ctx, err)
+		return results, confidence, nil, err
+	}
+	return results, confidence, data, nil
 }
@@ -9,6 +9,9 @@ import (
 	"stockbackend/types"
 	"strings"
 	"sync"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 var once sync.Once
@@ -24,7 +27,7 @@ func init() {
 }
 
 func CallGeminiAPI(sheet [][]string) types.MutualFundData {
-	if len(sheet) == 0 {
+	if len(sheet) == 0 || GEMINI_API_URL == "" {
 		return types.MutualFundData{}
 	}
 	prompt := fmt.Sprintf(`
@@ -46,7 +49,7 @@ Convert each portfolio holding row into a JSON object with these fields:
 
 Return ONLY this JSON structure:
 {
-  "nameOfMutualFund": "[EXTRACTED FUND NAME]",
+  "mutualFundName": "[EXTRACTED FUND NAME]",
   "fundData": [
     {
       "name": "...",
@@ -63,74 +66,24 @@ Return ONLY this JSON structure:
 The sheet data is:
 %s
 `, sheet)
-	requestData := types.GeminiRequest{
-		Contents: []struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
-		}{
-			{
-				Parts: []struct {
-					Text string `json:"text"`
-				}{
-					{
-						Text: prompt,
-					},
-				},
-			},
-		},
-		GenerationConfig: map[string]interface{}{
-			"maxOutputTokens": 200000,
-		},
-	}
-	requestBody, err := json.Marshal(requestData)
-	if err != nil {
-		return types.MutualFundData{}
-	}
-
-	apiEndpoint := GEMINI_API_URL + "?key=" + GEMINI_API_KEY
-	req, err := http.NewRequest("POST", apiEndpoint, bytes.NewBuffer(requestBody))
+	generatedText, err := callGemini(prompt)
 	if err != nil {
+		zap.L().Error("Error calling Gemini for holdings", zap.Error(err))
 		return types.MutualFundData{}
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return types.MutualFundData{}
-	}
-	defer resp.Body.Close()
-
-	var rawResponse types.APIResponse
-	err = json.NewDecoder(resp.Body).Decode(&rawResponse)
-	if err != nil {
+	var mutualFundData types.MutualFundData
+	if err := json.Unmarshal([]byte(generatedText), &mutualFundData); err != nil {
+		zap.L().Error("Error decoding Gemini holdings", zap.Error(err))
 		return types.MutualFundData{}
 	}
 
-	content := rawResponse.Candidates[0].Content
-	if len(content.Parts) > 0 {
-		part := content.Parts[0]
-		generatedText := part.Text
-		cleanedText := strings.TrimPrefix(generatedText, "```json")
-		cleanedText = strings.TrimSuffix(cleanedText, "```")
-		cleanedText = strings.TrimSpace(cleanedText)
-		//convert cleanedText to array Instrument
-		var mutualFundData types.MutualFundData
-		err = json.Unmarshal([]byte(cleanedText), &mutualFundData)
-		if err != nil {
-			return types.MutualFundData{}
-		}
-
-		sanitisedMutualFundData := types.MutualFundData{}
-		for _, fundData := range mutualFundData.FundData {
-			if strings.Contains(fundData.Isin, "IN") && len(fundData.Isin) == 12 {
-				sanitisedMutualFundData.FundData = append(sanitisedMutualFundData.FundData, fundData)
-			}
+	sanitisedMutualFundData := types.MutualFundData{MutualFundName: strings.TrimSpace(mutualFundData.MutualFundName)}
+	for _, fundData := range mutualFundData.FundData {
+		if strings.Contains(fundData.Isin, "IN") && len(fundData.Isin) == 12 {
+			sanitisedMutualFundData.FundData = append(sanitisedMutualFundData.FundData, fundData)
 		}
-		return sanitisedMutualFundData
 	}
-	return types.MutualFundData{}
+	return sanitisedMutualFundData
 }
 
 func CallGeminiAPI2(sheet []string) string {
@@ -335,3 +288,98 @@ Mutual Fund 2 Data:
 	}
 	return ""
 }
+
+// CallGeminiFundInfo asks the LLM for the scheme name, fund house and
+// portfolio date of a disclosure sheet, given the rows above its holdings.
+func CallGeminiFundInfo(titleRows [][]string) types.FundInfo {
+	if len(titleRows) == 0 || GEMINI_API_URL == "" {
+		return types.FundInfo{}
+	}
+	prompt := fmt.Sprintf(`You are a data processing assistant. The rows below are the title rows of a mutual fund monthly portfolio disclosure sheet.
+Identify:
+- schemeName: the full name of the mutual fund scheme, e.g. "HDFC Flexi Cap Fund"
+- amc: the fund house, e.g. "HDFC Mutual Fund"
+- asOfDate: the date the portfolio is stated as on, formatted YYYY-MM-DD
+
+Use an empty string for anything that is not present. Return ONLY this JSON structure:
+{
+  "schemeName": "...",
+  "amc": "...",
+  "asOfDate": "..."
+}
+
+The rows are:
+%s
+`, titleRows)
+
+	generatedText, err := callGemini(prompt)
+	if err != nil {
+		zap.L().Error("Error calling Gemini for fund info", zap.Error(err))
+		return types.FundInfo{}
+	}
+	var fundInfo types.FundInfo
+	if err := json.Unmarshal([]byte(generatedText), &fundInfo); err != nil {
+		zap.L().Error("Error decoding Gemini fund info", zap.Error(err))
+		return types.FundInfo{}
+	}
+	if _, err := time.Parse("2006-01-02", fundInfo.AsOfDate); err != nil {
+		fundInfo.AsOfDate = ""
+	}
+	return fundInfo
+}
+
+// callGemini sends a single prompt and returns the generated text with any
+// ```json fence removed
+func callGemini(prompt string) (string, error) {
+	requestData := types.GeminiRequest{
+		Contents: []struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		}{
+			{
+				Parts: []struct {
+					Text string `json:"text"`
+				}{
+					{
+						Text: prompt,
+					},
+				},
+			},
+		},
+		GenerationConfig: map[string]interface{}{
+			"maxOutputTokens": 200000,
+		},
+	}
+	requestBody, err := json.Marshal(requestData)
+	if err != nil {
+		return "", err
+	}
+
+	apiEndpoint := GEMINI_API_URL + "?key=" + GEMINI_API_KEY
+	req, err := http.NewRequest("POST", apiEndpoint, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var rawResponse types.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rawResponse); err != nil {
+		return "", err
+	}
+	if len(rawResponse.Candidates) == 0 || len(rawResponse.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("gemini returned no content")
+	}
+
+	generatedText := rawResponse.Candidates[0].Content.Parts[0].Text
+	cleanedText := strings.TrimPrefix(strings.TrimSpace(generatedText), "```json")
+	cleanedText = strings.TrimSuffix(strings.TrimSpace(cleanedText), "```")
+	return strings.TrimSpace(cleanedText), nil
+}
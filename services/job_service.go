@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"stockbackend/types"
+	"stockbackend/utils/events"
+	"stockbackend/utils/jobs"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+)
+
+// ErrJobQueueFull is returned by Submit when no more jobs can be queued
+var ErrJobQueueFull = jobs.ErrQueueFull
+
+type JobServiceI interface {
+	Start(workers int)
+	Submit(files []string, opts ParseOptions, cleanup func()) (types.Job, error)
+	Get(id string) (types.Job, bool)
+	ResultPath(id string) string
+}
+
+type queuedJob struct {
+	id    string
+	files []string
+	opts  ParseOptions
+	// cleanup removes the upload directory of the files once the job is done
+	cleanup func()
+}
+
+type jobService struct {
+	jobs    *jobs.Queue
+	janitor sync.Once
+}
+
+var JobService JobServiceI = &jobService{
+	jobs: jobs.NewQueue(100),
+}
+
+// jobResultWriter stores a job's event stream on disk as NDJSON. Every write goes
+// straight to the file so there is nothing to flush.
+type jobResultWriter struct {
+	*os.File
+}
+
+func (w jobResultWriter) Flush() {}
+
+func jobsDir() string {
+	if dir := os.Getenv("JOBS_DIR"); dir != "" {
+		return dir
+	}
+	return "./jobs"
+}
+
+// Start launches the background workers that drain the job queue, and the
+// janitor that removes finished jobs and their results after JOB_RETENTION.
+// Calling it more than once has no effect.
+func (js *jobService) Start(workers int) {
+	js.jobs.Start(workers)
+	js.janitor.Do(func() {
+		go js.sweep(jobs.RetentionFromEnv())
+	})
+}
+
+// Submit queues already saved upload files for parsing and returns the new
+// job. The job reports its own progress, replacing opts.Progress, and calls
+// cleanup when it ends. When the job cannot be queued, cleanup is left to
+// the caller.
+func (js *jobService) Submit(files []string, opts ParseOptions, cleanup func()) (types.Job, error) {
+	return js.jobs.Submit(func(id string) {
+		js.run(queuedJob{id: id, files: files, opts: opts, cleanup: cleanup})
+	})
+}
+
+func (js *jobService) Get(id string) (types.Job, bool) {
+	return js.jobs.Get(id)
+}
+
+// ResultPath is where the NDJSON output of a job is written
+func (js *jobService) ResultPath(id string) string {
+	return jobs.ResultPath(jobsDir(), id)
+}
+
+// sweep expires jobs now, to clear results left from before a restart, and
+// then every so often for as long as the server runs
+func (js *jobService) sweep(retention time.Duration) {
+	ticker := time.NewTicker(min(max(retention/4, time.Second), time.Hour))
+	defer ticker.Stop()
+	for {
+		js.expire(time.Now().Add(-retention))
+		<-ticker.C
+	}
+}
+
+// expire forgets the jobs that finished before cutoff and removes their
+// result files, along with any result file no known job owns
+func (js *jobService) expire(cutoff time.Time) {
+	expired := js.jobs.Expire(cutoff)
+	for _, id := range expired {
+		if err := os.Remove(js.ResultPath(id)); err != nil && !os.IsNotExist(err) {
+			zap.L().Error("Error removing job result", zap.String("jobId", id), zap.Error(err))
+		}
+	}
+	orphans, err := jobs.RemoveResults(jobsDir(), cutoff, func(id string) bool {
+		_, ok := js.jobs.Get(id)
+		return ok
+	})
+	if err != nil {
+		zap.L().Error("Error removing job results", zap.Error(err))
+	}
+	if len(expired) > 0 || len(orphans) > 0 {
+		zap.L().Info("Expired jobs", zap.Int("jobs", len(expired)), zap.Int("orphanedResults", len(orphans)))
+	}
+}
+
+func (js *jobService) run(job queuedJob) {
+	span := sentry.StartSpan(context.Background(), "[JOB] ParseXLSXFile", sentry.WithTransactionName("ParseXLSXFileJob"))
+	defer span.Finish()
+	if job.cleanup != nil {
+		defer job.cleanup()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			sentry.CurrentHub().Recover(r)
+			zap.L().Error("Job panicked", zap.String("jobId", job.id), zap.Any("panic", r))
+			span.Status = sentry.SpanStatusInternalError
+			js.jobs.Finish(job.id, fmt.Errorf("job panicked: %v", r))
+		}
+	}()
+
+	js.jobs.Update(job.id, func(j *types.Job) { j.Status = types.JobRunning })
+
+	files := make(chan string, len(job.files))
+	for _, file := range job.files {
+		files <- file
+	}
+	close(files)
+
+	if err := os.MkdirAll(jobsDir(), os.ModePerm); err != nil {
+		js.failAndCleanup(job, span, files, err)
+		return
+	}
+	out, err := os.Create(js.ResultPath(job.id))
+	if err != nil {
+		js.failAndCleanup(job, span, files, err)
+		return
+	}
+	defer out.Close()
+
+	opts := job.opts
+	opts.Progress = func(done, total int) {
+		js.jobs.Update(job.id, func(j *types.Job) {
+			j.Done = done
+			j.Total = total
+		})
+	}
+	stream := events.NewStream(jobResultWriter{out}, events.FormatNDJSON)
+	err = FileService.ParseXLSXFile(context.Background(), stream, files, opts, span.Context())
+	if closeErr := stream.Close(err); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		sentry.CaptureException(err)
+		zap.L().Error("Job failed", zap.String("jobId", job.id), zap.Error(err))
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+	js.jobs.Finish(job.id, err)
+}
+
+// failAndCleanup marks the job failed before parsing started and removes
+// the uploaded files it would otherwise have consumed.
+func (js *jobService) failAndCleanup(job queuedJob, span *sentry.Span, files <-chan string, err error) {
+	span.Status = sentry.SpanStatusInternalError
+	sentry.CaptureException(err)
+	zap.L().Error("Error preparing job output", zap.String("jobId", job.id), zap.Error(err))
+	for file := range files {
+		if err := os.Remove(file); err != nil {
+			zap.L().Error("Error removing file", zap.String("filePath", file), zap.Error(err))
+		}
+	}
+	js.jobs.Finish(job.id, err)
+}
@@ -2,116 +2,103 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"stockbackend/types"
+	"stockbackend/utils/events"
+	"stockbackend/utils/holdings"
+	"stockbackend/utils/overlap"
+	"strings"
 
 	"github.com/getsentry/sentry-go"
-	"github.com/gin-gonic/gin"
-	"github.com/xuri/excelize/v2"
 	"go.uber.org/zap"
 )
 
 type MFCompartorServiceI interface {
-	ParseXLSXFiles(ctx *gin.Context, files <-chan string, sentryCtx context.Context) error
+	ParseXLSXFiles(ctx context.Context, stream *events.Stream, files <-chan string, sentryCtx context.Context) error
 }
 
 type mFCompartorfileService struct{}
 
 var MFCompartorService MFCompartorServiceI = &mFCompartorfileService{}
 
-func (fs *mFCompartorfileService) ParseXLSXFiles(ctx *gin.Context, files <-chan string, sentryCtx context.Context) error {
+// ParseXLSXFiles reads a fund from every sheet of the files, as FileService
+// does, and streams the overlap of every pair. At least two funds are needed.
+func (fs *mFCompartorfileService) ParseXLSXFiles(ctx context.Context, stream *events.Stream, files <-chan string, sentryCtx context.Context) error {
 	defer sentry.Recover()
 	span := sentry.StartSpan(sentryCtx, "[DAO] ParseXLSXFile")
 	defer span.Finish()
 
 	var mfData []types.MFInstrument
-
+	profiles := headerProfiles()
 	for filePath := range files {
-		file, err := os.Open(filePath)
-		if err != nil {
-			sentry.CaptureException(err)
-			zap.L().Error("Error opening file", zap.String("filePath", filePath), zap.Error(err))
-			if err := os.Remove(filePath); err != nil {
-				zap.L().Error("Error removing file", zap.String("filePath", filePath), zap.Error(err))
-			} else {
-				zap.L().Info("File removed successfully", zap.String("filePath", filePath))
-			}
+		// Once the client has gone the remaining files are only removed
+		if ctx.Err() != nil {
+			removeFile(filePath)
 			continue
 		}
-		defer file.Close()
-
-		// Create a new reader from the uploaded file
-		if _, err := file.Seek(0, 0); err != nil {
-			zap.L().Error("Error seeking file", zap.String("filePath", filePath), zap.Error(err))
-			sentry.CaptureException(err)
-			return err
-		}
-
-		f, err := excelize.OpenReader(file)
-		if err != nil {
-			sentry.CaptureException(err)
-			zap.L().Error("Error parsing XLSX file", zap.String("filePath", filePath), zap.Error(err))
-			if err := os.Remove(filePath); err != nil {
-				zap.L().Error("Error removing file", zap.String("filePath", filePath), zap.Error(err))
-			} else {
-				zap.L().Info("File removed successfully", zap.String("filePath", filePath))
-			}
-			continue
+		// Holdings are read through the header profiles; only sheets they
+		// cannot read are sent to Gemini
+		sheets, warnings := readHoldings(ctx, span, profiles, readOptions{llmHoldings: true}, filePath)
+		for _, warning := range warnings {
+			stream.Warning(warning)
 		}
-		defer f.Close()
-
-		sheetList := f.GetSheetList()
-		for _, sheet := range sheetList {
-			zap.L().Info("Processing file", zap.String("filePath", filePath), zap.String("sheet", sheet))
-			// Get all the rows in the sheet
-			rows, err := f.GetRows(sheet)
-			if err != nil {
-				sentry.CaptureException(err)
-				zap.L().Error("Error reading rows from sheet", zap.String("sheet", sheet), zap.Error(err))
+		for _, sheet := range sheets {
+			instruments := holdings.Instruments(sheet.holdings)
+			if len(instruments) == 0 {
 				continue
 			}
-			mfSummary := CallGeminiAPI(rows)
-			if len(mfSummary.FundData) > 0 {
-				mfData = append(mfData, types.MFInstrument{
-					Instruments: mfSummary.FundData,
-					Name:        mfSummary.MutualFundName,
-				})
-			}
-		}
-		if err := os.Remove(filePath); err != nil {
-			sentry.CaptureException(err)
-			zap.L().Error("Error removing file", zap.String("filePath", filePath), zap.Error(err))
-		} else {
-			zap.L().Info("File removed successfully", zap.String("filePath", filePath))
+			zap.L().Info("Read fund", zap.String("sheet", sheet.name), zap.String("extraction", sheet.extraction), zap.Int("holdings", len(instruments)))
+			mfData = append(mfData, types.MFInstrument{
+				Name:        holdings.SchemeLabel(sheet.name, sheet.fund.SchemeName),
+				Instruments: resolveInstruments(ctx, instruments),
+				Extraction:  sheet.extraction,
+			})
 		}
-
 	}
-	mutualFund1WeightPercentage, mutualFund2WeightPercentage := calculateMutualFundOverlap(mfData[0].Instruments, mfData[1].Instruments)
-	mutualFund1Percentage, mutualFund2Percentage, commonStocks := calculateOverlapPercentage(mfData[0].Instruments, mfData[1].Instruments)
-
-	overlapMutualFund := types.OverlapMutualFund{
-		Fund1Percentage:       fmt.Sprintf("%.2f", mutualFund1Percentage),
-		Fund2Percentage:       fmt.Sprintf("%.2f", mutualFund2Percentage),
-		Fund1PercentageWeight: fmt.Sprintf("%.2f", mutualFund1WeightPercentage),
-		Fund2PercentageWeight: fmt.Sprintf("%.2f", mutualFund2WeightPercentage),
-		CommonStocks:          commonStocks,
+	if err := ctx.Err(); err != nil {
+		span.Status = sentry.SpanStatusCanceled
+		return err
 	}
-	jsonData, err := json.Marshal(overlapMutualFund)
+	comparison, err := overlap.Compare(mfData)
 	if err != nil {
-		sentry.CaptureException(err)
-		zap.L().Error("Error marshalling data to JSON", zap.Error(err))
-		return err
+		return fmt.Errorf("%w: %d found in the uploaded files", err, len(mfData))
 	}
-	_, err = ctx.Writer.Write(append(jsonData, '\n'))
+	return stream.Deliver(events.TypeRecord, comparison)
+}
 
-	if err != nil {
-		sentry.CaptureException(err)
-		zap.L().Error("Error writing data", zap.Error(err))
+// resolveInstruments looks instruments up in the security master by ISIN,
+// or by name when they have no ISIN, adding the NSE symbol and filling in
+// the missing ISINs so funds can be compared by ISIN
+func resolveInstruments(ctx context.Context, instruments []types.Instrument) []types.Instrument {
+	var isins, names []string
+	for i := range instruments {
+		instruments[i].Isin = strings.ToUpper(strings.TrimSpace(instruments[i].Isin))
+		if instruments[i].Isin != "" {
+			isins = append(isins, instruments[i].Isin)
+		} else if instruments[i].Name != "" {
+			names = append(names, instruments[i].Name)
+		}
+	}
 
+	byISIN, err := SecurityMasterService.ByISIN(ctx, isins)
+	if err != nil {
+		zap.L().Error("Error looking up security master", zap.Error(err))
+	}
+	byName, err := SecurityMasterService.ByName(ctx, names)
+	if err != nil {
+		zap.L().Error("Error looking up security master", zap.Error(err))
 	}
-	ctx.Writer.Flush()
 
-	return nil
+	for i, instrument := range instruments {
+		security, ok := byISIN[instrument.Isin]
+		if instrument.Isin == "" {
+			security, ok = byName[instrument.Name]
+		}
+		if !ok {
+			continue
+		}
+		instruments[i].Isin = security.ISIN
+		instruments[i].Symbol = security.NSESymbol
+	}
+	return instruments
 }
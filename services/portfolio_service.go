@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	mongo_client "stockbackend/clients/mongo"
+	"stockbackend/types"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ErrPortfolioNotFound is returned when no stored portfolio matches
+var ErrPortfolioNotFound = errors.New("portfolio not found")
+
+// PortfolioFilter selects stored portfolios. AMC and Scheme match
+// case-insensitively anywhere in the name; From and To are YYYY-MM-DD.
+type PortfolioFilter struct {
+	AMC      string
+	Scheme   string
+	From     string
+	To       string
+	Page     int
+	PageSize int
+}
+
+const (
+	defaultPortfolioPageSize = 20
+	maxPortfolioPageSize     = 100
+)
+
+type PortfolioServiceI interface {
+	Save(ctx context.Context, portfolio types.Portfolio) (types.Portfolio, error)
+	List(ctx context.Context, filter PortfolioFilter) ([]types.Portfolio, error)
+	Get(ctx context.Context, id string) (types.Portfolio, error)
+	Previous(ctx context.Context, portfolio types.Portfolio) (types.Portfolio, error)
+}
+
+type portfolioService struct {
+	indexOnce sync.Once
+}
+
+var PortfolioService PortfolioServiceI = &portfolioService{}
+
+// collection returns the portfolios collection, making sure on first use
+// that one scheme has at most one portfolio per date
+func (ps *portfolioService) collection() *mongo.Collection {
+	name := os.Getenv("PORTFOLIO_COLLECTION")
+	if name == "" {
+		name = "portfolios"
+	}
+	collection := mongo_client.Client.Database(os.Getenv("DATABASE")).Collection(name)
+	ps.indexOnce.Do(func() {
+		_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys:    primitive.D{{Key: "amc", Value: 1}, {Key: "schemeName", Value: 1}, {Key: "asOfDate", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			zap.L().Error("Error creating portfolio index", zap.Error(err))
+		}
+	})
+	return collection
+}
+
+// Save stores a portfolio, replacing the holdings of an earlier upload of
+// the same scheme and date. The archive link is kept when the new upload
+// was not archived.
+func (ps *portfolioService) Save(ctx context.Context, portfolio types.Portfolio) (types.Portfolio, error) {
+	now := time.Now()
+	filter := bson.M{"amc": portfolio.AMC, "schemeName": portfolio.SchemeName, "asOfDate": portfolio.AsOfDate}
+	update := bson.M{
+		"$set": bson.M{
+			"amc":        portfolio.AMC,
+			"schemeName": portfolio.SchemeName,
+			"asOfDate":   portfolio.AsOfDate,
+			"sheet":      portfolio.Sheet,
+			"sourceFile": portfolio.SourceFile,
+			"summary":    portfolio.Summary,
+			"holdings":   portfolio.Holdings,
+			"updatedAt":  now,
+		},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+	if portfolio.Archive != nil {
+		update["$set"].(bson.M)["archive"] = portfolio.Archive
+	}
+	updateOptions := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"_id": 1, "createdAt": 1})
+
+	var saved types.Portfolio
+	if err := ps.collection().FindOneAndUpdate(ctx, filter, update, updateOptions).Decode(&saved); err != nil {
+		return types.Portfolio{}, err
+	}
+	portfolio.ID = saved.ID
+	portfolio.CreatedAt = saved.CreatedAt
+	portfolio.UpdatedAt = now
+	return portfolio, nil
+}
+
+// List returns matching portfolios without their holdings, latest first
+func (ps *portfolioService) List(ctx context.Context, filter PortfolioFilter) ([]types.Portfolio, error) {
+	query := bson.M{}
+	if filter.AMC != "" {
+		query["amc"] = bson.M{"$regex": regexp.QuoteMeta(filter.AMC), "$options": "i"}
+	}
+	if filter.Scheme != "" {
+		query["schemeName"] = bson.M{"$regex": regexp.QuoteMeta(filter.Scheme), "$options": "i"}
+	}
+	dateRange := bson.M{}
+	if filter.From != "" {
+		dateRange["$gte"] = filter.From
+	}
+	if filter.To != "" {
+		dateRange["$lte"] = filter.To
+	}
+	if len(dateRange) > 0 {
+		query["asOfDate"] = dateRange
+	}
+
+	pageSize := filter.PageSize
+	if pageSize < 1 {
+		pageSize = defaultPortfolioPageSize
+	}
+	pageSize = min(pageSize, maxPortfolioPageSize)
+	page := max(filter.Page, 1)
+
+	findOptions := options.Find()
+	findOptions.SetProjection(bson.M{"holdings": 0})
+	findOptions.SetSort(primitive.D{{Key: "asOfDate", Value: -1}, {Key: "schemeName", Value: 1}})
+	findOptions.SetLimit(int64(pageSize))
+	findOptions.SetSkip(int64(pageSize * (page - 1)))
+
+	cursor, err := ps.collection().Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	portfolios := []types.Portfolio{}
+	if err := cursor.All(ctx, &portfolios); err != nil {
+		return nil, err
+	}
+	return portfolios, nil
+}
+
+// Get returns one portfolio with its holdings
+func (ps *portfolioService) Get(ctx context.Context, id string) (types.Portfolio, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return types.Portfolio{}, ErrPortfolioNotFound
+	}
+	var portfolio types.Portfolio
+	err = ps.collection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&portfolio)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.Portfolio{}, ErrPortfolioNotFound
+	}
+	if err != nil {
+		return types.Portfolio{}, err
+	}
+	return portfolio, nil
+}
+
+// Previous returns the latest stored portfolio of the same scheme dated
+// before the given one
+func (ps *portfolioService) Previous(ctx context.Context, portfolio types.Portfolio) (types.Portfolio, error) {
+	filter := bson.M{
+		"amc":        portfolio.AMC,
+		"schemeName": portfolio.SchemeName,
+		"asOfDate":   bson.M{"$lt": portfolio.AsOfDate},
+	}
+	findOptions := options.FindOne().SetSort(bson.M{"asOfDate": -1})
+
+	var previous types.Portfolio
+	err := ps.collection().FindOne(ctx, filter, findOptions).Decode(&previous)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.Portfolio{}, ErrPortfolioNotFound
+	}
+	if err != nil {
+		return types.Portfolio{}, err
+	}
+	return previous, nil
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	mongo_client "stockbackend/clients/mongo"
+	"stockbackend/types"
+	"stockbackend/utils/names"
+	"stockbackend/utils/securitymaster"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ErrSecurityNotFound is returned when the security master has no such ISIN
+var ErrSecurityNotFound = errors.New("security not found")
+
+// ErrInvalidMasterFile is returned for import file names outside SECURITY_MASTER_DIR
+var ErrInvalidMasterFile = errors.New("invalid security master file")
+
+// ImportResult counts what one master file added to the security master
+type ImportResult struct {
+	File       string `json:"file"`
+	Securities int    `json:"securities"`
+	Inserted   int64  `json:"inserted"`
+	Updated    int64  `json:"updated"`
+	Error      string `json:"error,omitempty"`
+}
+
+type SecurityMasterServiceI interface {
+	Import(ctx context.Context, files []string) ([]ImportResult, error)
+	Get(ctx context.Context, isin string) (types.Security, error)
+	ByISIN(ctx context.Context, isins []string) (map[string]types.Security, error)
+	ByName(ctx context.Context, companyNames []string) (map[string]types.Security, error)
+}
+
+type securityMasterService struct {
+	indexOnce sync.Once
+}
+
+var SecurityMasterService SecurityMasterServiceI = &securityMasterService{}
+
+// collection returns the securities collection, indexing it by ISIN and
+// name key on first use
+func (ss *securityMasterService) collection() *mongo.Collection {
+	name := os.Getenv("SECURITY_COLLECTION")
+	if name == "" {
+		name = "securities"
+	}
+	collection := mongo_client.Client.Database(os.Getenv("DATABASE")).Collection(name)
+	ss.indexOnce.Do(func() {
+		_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+			{Keys: bson.M{"isin": 1}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.M{"nameKey": 1}},
+		})
+		if err != nil {
+			zap.L().Error("Error creating security indexes", zap.Error(err))
+		}
+	})
+	return collection
+}
+
+// masterFilePath resolves an import file name inside SECURITY_MASTER_DIR.
+// Only plain file names are accepted so the endpoint cannot read anything
+// else on the server.
+func masterFilePath(file string) (string, error) {
+	dir := os.Getenv("SECURITY_MASTER_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("%w: SECURITY_MASTER_DIR is not set", ErrInvalidMasterFile)
+	}
+	if file == "" || file != filepath.Base(file) || strings.HasPrefix(file, ".") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidMasterFile, file)
+	}
+	return filepath.Join(dir, file), nil
+}
+
+// Import reads exchange equity master CSVs from SECURITY_MASTER_DIR and
+// upserts their securities by ISIN. Fields a file does not have, such as
+// the BSE code in NSE's list, are left as they are so both exchanges'
+// files can be imported one after the other.
+func (ss *securityMasterService) Import(ctx context.Context, files []string) ([]ImportResult, error) {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		path, err := masterFilePath(file)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = path
+	}
+
+	results := make([]ImportResult, len(files))
+	for i, path := range paths {
+		results[i] = ss.importFile(ctx, files[i], path)
+	}
+	return results, nil
+}
+
+func (ss *securityMasterService) importFile(ctx context.Context, name, path string) ImportResult {
+	result := ImportResult{File: name}
+	file, err := os.Open(path)
+	if err != nil {
+		zap.L().Error("Error opening security master file", zap.String("file", name), zap.Error(err))
+		result.Error = "Error opening file"
+		return result
+	}
+	defer file.Close()
+
+	securities, err := securitymaster.Parse(file)
+	if err != nil {
+		zap.L().Error("Error parsing security master file", zap.String("file", name), zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	result.Securities = len(securities)
+
+	now := time.Now()
+	for start := 0; start < len(securities); start += lookupBatchSize {
+		var models []mongo.WriteModel
+		for _, security := range securities[start:min(start+lookupBatchSize, len(securities))] {
+			set := bson.M{"name": security.Name, "nameKey": security.NameKey, "updatedAt": now}
+			if security.NSESymbol != "" {
+				set["nseSymbol"] = security.NSESymbol
+			}
+			if security.BSECode != "" {
+				set["bseCode"] = security.BSECode
+			}
+			if security.FaceValue != 0 {
+				set["faceValue"] = security.FaceValue
+			}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"isin": security.ISIN}).
+				SetUpdate(bson.M{"$set": set}).
+				SetUpsert(true))
+		}
+		written, err := ss.collection().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if written != nil {
+			result.Inserted += written.UpsertedCount
+			result.Updated += written.ModifiedCount
+		}
+		if err != nil {
+			zap.L().Error("Error importing securities", zap.String("file", name), zap.Error(err))
+			result.Error = "Error writing securities"
+			return result
+		}
+	}
+	zap.L().Info("Imported security master file", zap.String("file", name), zap.Int("securities", result.Securities))
+	return result
+}
+
+// Get returns the security with the given ISIN
+func (ss *securityMasterService) Get(ctx context.Context, isin string) (types.Security, error) {
+	var security types.Security
+	err := ss.collection().FindOne(ctx, bson.M{"isin": strings.ToUpper(strings.TrimSpace(isin))}).Decode(&security)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.Security{}, ErrSecurityNotFound
+	}
+	if err != nil {
+		return types.Security{}, err
+	}
+	return security, nil
+}
+
+// ByISIN returns the known securities among the ISINs, keyed by ISIN
+func (ss *securityMasterService) ByISIN(ctx context.Context, isins []string) (map[string]types.Security, error) {
+	found := make(map[string]types.Security)
+	for start := 0; start < len(isins); start += lookupBatchSize {
+		securities, err := ss.find(ctx, bson.M{"isin": bson.M{"$in": batch(isins, start)}})
+		if err != nil {
+			return found, err
+		}
+		for _, security := range securities {
+			found[security.ISIN] = security
+		}
+	}
+	return found, nil
+}
+
+// ByName returns the securities whose name is spelled like one of the
+// names, keyed by the name as given. Names shared by several securities
+// are left out.
+func (ss *securityMasterService) ByName(ctx context.Context, companyNames []string) (map[string]types.Security, error) {
+	byKey := make(map[string][]string)
+	var keys []string
+	for _, name := range companyNames {
+		key := names.Key(name)
+		if key == "" {
+			continue
+		}
+		if _, seen := byKey[key]; !seen {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], name)
+	}
+
+	found := make(map[string]types.Security)
+	for start := 0; start < len(keys); start += lookupBatchSize {
+		securities, err := ss.find(ctx, bson.M{"nameKey": bson.M{"$in": batch(keys, start)}})
+		if err != nil {
+			return found, err
+		}
+		matches := make(map[string][]types.Security)
+		for _, security := range securities {
+			matches[security.NameKey] = append(matches[security.NameKey], security)
+		}
+		for key, securities := range matches {
+			if len(securities) != 1 {
+				continue
+			}
+			for _, name := range byKey[key] {
+				found[name] = securities[0]
+			}
+		}
+	}
+	return found, nil
+}
+
+func (ss *securityMasterService) find(ctx context.Context, filter bson.M) ([]types.Security, error) {
+	cursor, err := ss.collection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var securities []types.Security
+	if err := cursor.All(ctx, &securities); err != nil {
+		return nil, err
+	}
+	return securities, nil
+}
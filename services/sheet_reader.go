@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+
+	"stockbackend/utils/sheets"
+	"stockbackend/utils/upload"
+)
+
+// ErrSheetTooLarge is returned when a sheet has more rows than XLSX_MAX_ROWS
+var ErrSheetTooLarge = sheets.ErrSheetTooLarge
+
+// sheetLimits bound how much of an uploaded file is held in memory and
+// read, whatever its format
+type sheetLimits struct {
+	// unzipSize caps the total uncompressed size of the workbook
+	unzipSize int64
+	// unzipXMLSize is the size above which a worksheet is spooled to a
+	// temp file instead of being unzipped into memory
+	unzipXMLSize int64
+	// fileBytes caps the workbook stream read from an XLS file
+	fileBytes  int64
+	maxRows    int
+	maxColumns int
+}
+
+func currentSheetLimits() sheetLimits {
+	return sheetLimits{
+		unzipSize:    int64(envInt("XLSX_UNZIP_LIMIT_MB", 256)) << 20,
+		unzipXMLSize: int64(envInt("XLSX_SHEET_MEMORY_LIMIT_MB", 16)) << 20,
+		fileBytes:    upload.LimitsFromEnv().MaxFileBytes,
+		maxRows:      envInt("XLSX_MAX_ROWS", 100000),
+		maxColumns:   envInt("XLSX_MAX_COLUMNS", 256),
+	}
+}
+
+// openWorkbook opens an XLSX, XLS or CSV file, telling which from its
+// content, with the configured limits
+func openWorkbook(filePath string) (sheets.Workbook, error) {
+	limits := currentSheetLimits()
+	return sheets.Open(filePath, sheets.Options{
+		UnzipSizeLimit:    limits.unzipSize,
+		UnzipXMLSizeLimit: min(limits.unzipXMLSize, limits.unzipSize),
+		MaxFileBytes:      limits.fileBytes,
+		MaxRows:           limits.maxRows,
+		MaxColumns:        limits.maxColumns,
+	})
+}
+
+// eachRow streams the rows of a sheet to fn one at a time until fn returns
+// false. Rows wider than XLSX_MAX_COLUMNS are truncated and sheets longer
+// than XLSX_MAX_ROWS fail with ErrSheetTooLarge, whatever the file format.
+func eachRow(f sheets.Workbook, sheet string, fn func(row []string) bool) error {
+	limits := currentSheetLimits()
+	count := 0
+	var tooLarge error
+	err := f.Rows(sheet, func(row []string) bool {
+		count++
+		if count > limits.maxRows {
+			tooLarge = fmt.Errorf("%w: %s has more than %d rows", ErrSheetTooLarge, sheet, limits.maxRows)
+			return false
+		}
+		if len(row) > limits.maxColumns {
+			row = row[:limits.maxColumns]
+		}
+		return fn(row)
+	})
+	if err != nil {
+		return err
+	}
+	return tooLarge
+}
+
+// collectRows reads a whole sheet within the configured limits
+func collectRows(f sheets.Workbook, sheet string) ([][]string, error) {
+	var rows [][]string
+	err := eachRow(f, sheet, func(row []string) bool {
+		rows = append(rows, row)
+		return true
+	})
+	return rows, err
+}
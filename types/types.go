@@ -1,5 +1,11 @@
 package types
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
 // Stock represents the data of a stock
 type Stock struct {
 	Name            string
@@ -19,6 +25,13 @@ type Company struct {
 	URL  string `json:"url"`
 }
 
+// CompanyCandidate is a company an unresolved holding may refer to
+type CompanyCandidate struct {
+	Name       string  `json:"name"`
+	URL        string  `json:"url,omitempty"`
+	Similarity float64 `json:"similarity"`
+}
+
 type GeminiResponse struct {
 	Name       string   `json:"name"`
 	Percentage float64  `json:"percentage"`
@@ -54,6 +67,7 @@ type Instrument struct {
 	Quantity    string `json:"quantity"`
 	MarketValue string `json:"marketValue"`
 	Percentage  string `json:"percentage"`
+	Symbol      string `json:"symbol,omitempty"`
 }
 
 type MutualFundData struct {
@@ -64,14 +78,69 @@ type MutualFundData struct {
 type MFInstrument struct {
 	Name        string `json:"name"`
 	Instruments []Instrument
+	// Extraction is how the holdings were read: "header" or "llm"
+	Extraction string `json:"extraction,omitempty"`
+}
+
+// FundComparison is the overlap between every pair of the compared funds.
+// Matrix[i][j] is how much of fund i is also held by fund j.
+type FundComparison struct {
+	Funds          []ComparedFund   `json:"funds"`
+	Matrix         [][]FundOverlap  `json:"matrix"`
+	CommonToAll    []CommonHolding  `json:"commonToAll"`
+	UniqueHoldings []UniqueHoldings `json:"uniqueHoldings"`
+}
+
+// ComparedFund is one of the funds of a comparison
+type ComparedFund struct {
+	Name        string  `json:"name"`
+	Holdings    int     `json:"holdings"`
+	TotalWeight float64 `json:"totalWeight"`
+	// Extraction is how the holdings were read: "header" or "llm"
+	Extraction string `json:"extraction,omitempty"`
+}
+
+// FundOverlap is the part of one fund that another fund also holds
+type FundOverlap struct {
+	// Common is the number of holdings both funds hold
+	Common int `json:"common"`
+	// CountPercentage is Common as a percentage of the fund's holdings
+	CountPercentage float64 `json:"countPercentage"`
+	// WeightPercentage is the %NAV of the fund in the common holdings
+	WeightPercentage float64 `json:"weightPercentage"`
+	// Similarity is the same both ways round
+	Similarity Similarity `json:"similarity"`
 }
 
-type OverlapMutualFund struct {
-	CommonStocks          []Instrument
-	Fund1Percentage       string
-	Fund2Percentage       string
-	Fund1PercentageWeight string
-	Fund2PercentageWeight string
+// Similarity measures how alike two funds are
+type Similarity struct {
+	// WeightOverlap is the %NAV both funds have in the same holdings: the
+	// sum of the smaller weight of each common holding
+	WeightOverlap float64 `json:"weightOverlap"`
+	// Jaccard is the common holdings over the holdings of either fund
+	Jaccard float64 `json:"jaccard"`
+	// Cosine is the cosine similarity of the funds' weights
+	Cosine float64 `json:"cosine"`
+	// ActiveShare is how much of one fund differs from the other, from 0
+	// to 100
+	ActiveShare float64 `json:"activeShare"`
+	// SectorOverlap is the %NAV both funds have in the same sectors
+	SectorOverlap float64 `json:"sectorOverlap"`
+}
+
+// CommonHolding is held by every compared fund. Weights lists its %NAV in
+// each fund, in the order of the funds.
+type CommonHolding struct {
+	Name    string    `json:"name"`
+	Isin    string    `json:"isin,omitempty"`
+	Symbol  string    `json:"symbol,omitempty"`
+	Weights []float64 `json:"weights"`
+}
+
+// UniqueHoldings are the holdings of a fund that no other compared fund holds
+type UniqueHoldings struct {
+	Fund     string       `json:"fund"`
+	Holdings []Instrument `json:"holdings"`
 }
 
 // ValuationData represents the comprehensive valuation data for a company
@@ -112,3 +181,166 @@ const (
 	HOLD RecommendationType = "HOLD"
 	SELL RecommendationType = "SELL"
 )
+
+// JobStatus is the lifecycle state of an asynchronous upload job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job tracks an upload that is parsed and scored in the background
+type Job struct {
+	ID        string    `json:"id"`
+	Status    JobStatus `json:"status"`
+	Done      int       `json:"done"`
+	Total     int       `json:"total"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Allocation is how much of a portfolio sits in one asset class
+type Allocation struct {
+	AssetClass string  `json:"assetClass" bson:"assetClass"`
+	Holdings   int     `json:"holdings" bson:"holdings"`
+	Weight     float64 `json:"weight" bson:"weight"`
+}
+
+// FundInfo identifies the scheme and month a disclosure sheet belongs to
+type FundInfo struct {
+	SchemeName string `json:"schemeName,omitempty" bson:"schemeName,omitempty"`
+	AMC        string `json:"amc,omitempty" bson:"amc,omitempty"`
+	AsOfDate   string `json:"asOfDate,omitempty" bson:"asOfDate,omitempty"` // YYYY-MM-DD
+	Source     string `json:"source,omitempty" bson:"source,omitempty"`     // "sheet" or "llm"
+}
+
+// MarketCapBucket is the share of a portfolio in one market-cap category
+type MarketCapBucket struct {
+	Category string  `json:"category" bson:"category"`
+	Holdings int     `json:"holdings" bson:"holdings"`
+	Weight   float64 `json:"weight" bson:"weight"`
+}
+
+// PortfolioSummary is streamed after the holdings of each sheet. Weights
+// are in %NAV.
+type PortfolioSummary struct {
+	Scheme            string            `json:"scheme" bson:"scheme"`
+	Sheet             string            `json:"sheet" bson:"sheet"`
+	Fund              FundInfo          `json:"fund" bson:"fund"`
+	PortfolioID       string            `json:"portfolioId,omitempty" bson:"portfolioId,omitempty"`
+	HeaderProfile     string            `json:"headerProfile,omitempty" bson:"headerProfile,omitempty"`
+	Extraction        string            `json:"extraction" bson:"extraction"`
+	Offline           bool              `json:"offline,omitempty" bson:"offline,omitempty"`
+	Holdings          int               `json:"holdings" bson:"holdings"`
+	Resolved          int               `json:"resolved" bson:"resolved"`
+	Unresolved        int               `json:"unresolved" bson:"unresolved"`
+	Allocation        []Allocation      `json:"allocation" bson:"allocation"`
+	MarketCaps        []MarketCapBucket `json:"marketCaps" bson:"marketCaps"`
+	WeightedStockRate float64           `json:"weightedStockRate" bson:"weightedStockRate"`
+	WeightedFScore    float64           `json:"weightedFScore" bson:"weightedFScore"`
+	Top10Weight       float64           `json:"top10Weight" bson:"top10Weight"`
+	TotalWeight       float64           `json:"totalWeight" bson:"totalWeight"`
+	WeightCovered     float64           `json:"weightCovered" bson:"weightCovered"`
+}
+
+// PortfolioHolding is one line of a stored portfolio disclosure. Weight is
+// in %NAV; quantity and market value are as printed in the disclosure.
+type PortfolioHolding struct {
+	Name        string      `json:"name" bson:"name"`
+	ISIN        string      `json:"isin,omitempty" bson:"isin,omitempty"`
+	Industry    string      `json:"industry,omitempty" bson:"industry,omitempty"`
+	AssetClass  string      `json:"assetClass" bson:"assetClass"`
+	Section     string      `json:"section,omitempty" bson:"section,omitempty"`
+	Quantity    float64     `json:"quantity" bson:"quantity"`
+	MarketValue float64     `json:"marketValue" bson:"marketValue"`
+	Weight      float64     `json:"weight" bson:"weight"`
+	Status      string      `json:"status,omitempty" bson:"status,omitempty"`
+	CompanyID   interface{} `json:"companyId,omitempty" bson:"companyId,omitempty"`
+}
+
+// Portfolio is the stored holdings of one scheme as of one date
+type Portfolio struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SchemeName string             `json:"schemeName" bson:"schemeName"`
+	AMC        string             `json:"amc,omitempty" bson:"amc,omitempty"`
+	AsOfDate   string             `json:"asOfDate" bson:"asOfDate"` // YYYY-MM-DD
+	Sheet      string             `json:"sheet,omitempty" bson:"sheet,omitempty"`
+	SourceFile string             `json:"sourceFile,omitempty" bson:"sourceFile,omitempty"`
+	Summary    PortfolioSummary   `json:"summary" bson:"summary"`
+	Holdings   []PortfolioHolding `json:"holdings,omitempty" bson:"holdings,omitempty"`
+	Archive    *ArchivedFile      `json:"archive,omitempty" bson:"archive,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// ArchivedFile is where an uploaded workbook was archived. The key is
+// derived from the SHA-256 of the file, so identical uploads share a blob.
+type ArchivedFile struct {
+	Backend  string `json:"backend" bson:"backend"`
+	Key      string `json:"key" bson:"key"`
+	SHA256   string `json:"sha256" bson:"sha256"`
+	Location string `json:"location,omitempty" bson:"location,omitempty"`
+	Size     int64  `json:"size" bson:"size"`
+}
+
+// HoldingChange is how one holding moved between two portfolio dates.
+// Weights are in %NAV.
+type HoldingChange struct {
+	ISIN             string  `json:"isin,omitempty"`
+	Name             string  `json:"name"`
+	AssetClass       string  `json:"assetClass"`
+	PreviousWeight   float64 `json:"previousWeight"`
+	CurrentWeight    float64 `json:"currentWeight"`
+	WeightChange     float64 `json:"weightChange"`
+	PreviousQuantity float64 `json:"previousQuantity"`
+	CurrentQuantity  float64 `json:"currentQuantity"`
+	QuantityChange   float64 `json:"quantityChange"`
+}
+
+// PortfolioChanges reports what a scheme bought and sold between two
+// disclosures. Turnover is the smaller of purchases and sales as a
+// percentage of the average portfolio value.
+type PortfolioChanges struct {
+	SchemeName   string          `json:"schemeName"`
+	AMC          string          `json:"amc,omitempty"`
+	PreviousDate string          `json:"previousDate"`
+	CurrentDate  string          `json:"currentDate"`
+	Entries      []HoldingChange `json:"entries"`
+	Exits        []HoldingChange `json:"exits"`
+	Increased    []HoldingChange `json:"increased"`
+	Decreased    []HoldingChange `json:"decreased"`
+	Unchanged    int             `json:"unchanged"`
+	Turnover     float64         `json:"turnover"`
+}
+
+// Security is one listed equity in the security master, keyed by ISIN
+type Security struct {
+	ISIN      string    `json:"isin" bson:"isin"`
+	NSESymbol string    `json:"nseSymbol,omitempty" bson:"nseSymbol,omitempty"`
+	BSECode   string    `json:"bseCode,omitempty" bson:"bseCode,omitempty"`
+	Name      string    `json:"name" bson:"name"`
+	NameKey   string    `json:"-" bson:"nameKey"`
+	FaceValue float64   `json:"faceValue,omitempty" bson:"faceValue,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CompanyAlias maps a name companies are disclosed under to the company
+// document it is. Aliases learned by the resolver are unconfirmed until an
+// admin confirms them, and keep the confidence of the match they were
+// learned from; confirmed aliases are never overwritten by learning.
+type CompanyAlias struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Alias       string             `json:"alias" bson:"alias"`
+	Key         string             `json:"key" bson:"key"`
+	CompanyID   primitive.ObjectID `json:"companyId,omitempty" bson:"companyId,omitempty"`
+	CompanyName string             `json:"companyName" bson:"companyName"`
+	Confirmed   bool               `json:"confirmed" bson:"confirmed"`
+	Confidence  float64            `json:"confidence,omitempty" bson:"confidence,omitempty"`
+	Source      string             `json:"source" bson:"source"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
@@ -1,11 +1,49 @@
 package constants
 
-var (
-	MapValues = map[string]string{
-		"Sun Pharmaceutical Industries Limited":       "Sun Pharma.Inds.",
-		"KEC International Limited":                   "K E C Intl.",
-		"Sandhar Technologies Limited":                "Sandhar Tech",
-		"Samvardhana Motherson International Limited": "Samvardh. Mothe.",
-		"Coromandel International Limited":            "Coromandel Inter",
-	}
-)
+// AMCNames are the fund houses whose names lead their scheme names, longest
+// first so "ICICI Prudential" is matched before a shorter prefix would be
+var AMCNames = []string{
+	"Aditya Birla Sun Life",
+	"Baroda BNP Paribas",
+	"Franklin Templeton",
+	"Mahindra Manulife",
+	"WhiteOak Capital",
+	"ICICI Prudential",
+	"Canara Robeco",
+	"Motilal Oswal",
+	"Bajaj Finserv",
+	"Parag Parikh",
+	"Bank of India",
+	"Nippon India",
+	"Mirae Asset",
+	"Old Bridge",
+	"PGIM India",
+	"Edelweiss",
+	"Invesco",
+	"Bandhan",
+	"Quantum",
+	"Shriram",
+	"Sundaram",
+	"360 ONE",
+	"Helios",
+	"Zerodha",
+	"Taurus",
+	"Kotak",
+	"Groww",
+	"Samco",
+	"Union",
+	"Quant",
+	"Trust",
+	"HDFC",
+	"HSBC",
+	"Axis",
+	"Tata",
+	"Navi",
+	"LIC",
+	"SBI",
+	"UTI",
+	"DSP",
+	"ITI",
+	"JM",
+	"NJ",
+}
@@ -0,0 +1,253 @@
+// Package events is the protocol of every streamed response: a sequence of
+// typed events, sent as NDJSON envelopes or as Server-Sent Events, that
+// always ends with a done event telling the client how the run went.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Event types
+const (
+	// TypeProgress reports how far a run has got
+	TypeProgress = "progress"
+	// TypeRecord carries one result, such as a scored holding
+	TypeRecord = "record"
+	// TypeWarning reports something that was skipped; the run goes on
+	TypeWarning = "warning"
+	// TypeError reports the failure that ended the run
+	TypeError = "error"
+	// TypeSummary closes a group of records, such as the holdings of a sheet
+	TypeSummary = "summary"
+	// TypeDone is always the last event
+	TypeDone = "done"
+)
+
+// Known reports whether t is one of the event types
+func Known(t string) bool {
+	switch t {
+	case TypeProgress, TypeRecord, TypeWarning, TypeError, TypeSummary, TypeDone:
+		return true
+	}
+	return false
+}
+
+// Statuses of the done event
+const (
+	// StatusOK means everything was read and sent
+	StatusOK = "ok"
+	// StatusPartial means the run finished but warnings were sent
+	StatusPartial = "partial"
+	// StatusFailed means an error ended the run early
+	StatusFailed = "failed"
+)
+
+// Stream formats
+const (
+	FormatNDJSON = "ndjson"
+	FormatSSE    = "sse"
+)
+
+// Content types of the stream formats
+const (
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeSSE    = "text/event-stream"
+)
+
+// Envelope is one NDJSON line of a stream
+type Envelope struct {
+	Type string          `json:"type"`
+	Seq  int             `json:"seq"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Progress is the data of a progress event
+type Progress struct {
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	File  string `json:"file,omitempty"`
+	Sheet string `json:"sheet,omitempty"`
+}
+
+// Notice is the data of a warning or error event
+type Notice struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Sheet   string `json:"sheet,omitempty"`
+}
+
+// CodeFailed is the code of the error event sent by Close
+const CodeFailed = "failed"
+
+// Done is the data of the done event
+type Done struct {
+	Status    string `json:"status"`
+	Records   int    `json:"records"`
+	Summaries int    `json:"summaries"`
+	Warnings  int    `json:"warnings"`
+	Errors    int    `json:"errors"`
+}
+
+// Writer is where a stream is written. gin.ResponseWriter satisfies it.
+type Writer interface {
+	io.Writer
+	Flush()
+}
+
+// Stream writes the events of one response. It is safe for concurrent
+// use. After the first write error every later event is dropped and the
+// error is returned again, so a producer can stop once the client is gone.
+type Stream struct {
+	w      Writer
+	format string
+	mu     sync.Mutex
+	seq    int
+	counts Done
+	err    error
+	closed bool
+}
+
+// NewStream returns a stream writing format to w. Unknown formats are
+// written as NDJSON.
+func NewStream(w Writer, format string) *Stream {
+	if format != FormatSSE {
+		format = FormatNDJSON
+	}
+	return &Stream{w: w, format: format}
+}
+
+// FormatFor picks the stream format for an Accept header: SSE when it
+// asks for text/event-stream, NDJSON otherwise
+func FormatFor(accept string) string {
+	if strings.Contains(accept, ContentTypeSSE) {
+		return FormatSSE
+	}
+	return FormatNDJSON
+}
+
+// ContentType is the content type to send before the first event
+func (s *Stream) ContentType() string {
+	if s.format == FormatSSE {
+		return ContentTypeSSE
+	}
+	return ContentTypeNDJSON
+}
+
+// Send writes one event and flushes it to the client straight away
+func (s *Stream) Send(eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshalling %s event: %w", eventType, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.closed {
+		return fmt.Errorf("%s event sent after done", eventType)
+	}
+	s.seq++
+	var frame []byte
+	if s.format == FormatSSE {
+		frame = []byte(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", s.seq, eventType, payload))
+	} else {
+		frame, _ = json.Marshal(Envelope{Type: eventType, Seq: s.seq, Data: payload})
+		frame = append(frame, '\n')
+	}
+	if _, err := s.w.Write(frame); err != nil {
+		s.err = err
+		return err
+	}
+	s.w.Flush()
+
+	switch eventType {
+	case TypeRecord:
+		s.counts.Records++
+	case TypeSummary:
+		s.counts.Summaries++
+	case TypeWarning:
+		s.counts.Warnings++
+	case TypeError:
+		s.counts.Errors++
+	case TypeDone:
+		s.closed = true
+	}
+	return nil
+}
+
+// Deliver sends one event and logs why it could not be. It returns an
+// error only once the client is gone; an event that cannot be marshalled
+// is skipped.
+func (s *Stream) Deliver(eventType string, data interface{}) error {
+	err := s.Send(eventType, data)
+	if err == nil {
+		return nil
+	}
+	if s.Err() == nil {
+		zap.L().Error("Error marshalling data", zap.String("type", eventType), zap.Error(err))
+		return nil
+	}
+	zap.L().Error("Error writing data", zap.String("type", eventType), zap.Error(err))
+	return err
+}
+
+// Record sends one result
+func (s *Stream) Record(data interface{}) error {
+	return s.Send(TypeRecord, data)
+}
+
+// Summary closes a group of records
+func (s *Stream) Summary(data interface{}) error {
+	return s.Send(TypeSummary, data)
+}
+
+// Progress reports how many items are done out of those found so far
+func (s *Stream) Progress(progress Progress) error {
+	return s.Send(TypeProgress, progress)
+}
+
+// Warning reports something that was skipped
+func (s *Stream) Warning(notice Notice) error {
+	return s.Send(TypeWarning, notice)
+}
+
+// Close ends the stream with the done event. A non-nil err is sent as an
+// error event first and fails the run.
+func (s *Stream) Close(err error) error {
+	if err != nil {
+		s.Send(TypeError, Notice{Code: CodeFailed, Message: err.Error()})
+	}
+	return s.Send(TypeDone, s.Done())
+}
+
+// Done is what the done event would report now
+func (s *Stream) Done() Done {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done := s.counts
+	switch {
+	case done.Errors > 0:
+		done.Status = StatusFailed
+	case done.Warnings > 0:
+		done.Status = StatusPartial
+	default:
+		done.Status = StatusOK
+	}
+	return done
+}
+
+// Err is the write error that stopped the stream, if any
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,153 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type buffer struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (b *buffer) Flush() { b.flushes++ }
+
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) { return 0, errors.New("client gone") }
+func (brokenWriter) Flush()                      {}
+
+func TestStream_NDJSON(t *testing.T) {
+	var out buffer
+	stream := NewStream(&out, FormatNDJSON)
+	if stream.ContentType() != ContentTypeNDJSON {
+		t.Errorf("Expected %v, got %v", ContentTypeNDJSON, stream.ContentType())
+	}
+	stream.Progress(Progress{Done: 0, Total: 2, Sheet: "AXISBF"})
+	stream.Record(map[string]interface{}{"name": "Infosys Ltd"})
+	stream.Summary(map[string]interface{}{"scheme": "Axis Bluechip Fund"})
+	if err := stream.Close(nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || out.flushes != 4 {
+		t.Fatalf("Expected 4 flushed lines, got %v lines and %v flushes", len(lines), out.flushes)
+	}
+	expected := []string{TypeProgress, TypeRecord, TypeSummary, TypeDone}
+	for i, line := range lines {
+		var envelope Envelope
+		if err := json.Unmarshal([]byte(line), &envelope); err != nil {
+			t.Fatalf("Expected an envelope, got %v", line)
+		}
+		if envelope.Type != expected[i] || envelope.Seq != i+1 {
+			t.Errorf("Expected %v event %d, got %v event %d", expected[i], i+1, envelope.Type, envelope.Seq)
+		}
+	}
+	var envelope Envelope
+	json.Unmarshal([]byte(lines[3]), &envelope)
+	var done Done
+	json.Unmarshal(envelope.Data, &done)
+	if done != (Done{Status: StatusOK, Records: 1, Summaries: 1}) {
+		t.Errorf("Expected an ok done event, got %+v", done)
+	}
+}
+
+func TestStream_SSE(t *testing.T) {
+	var out buffer
+	stream := NewStream(&out, FormatSSE)
+	if stream.ContentType() != ContentTypeSSE {
+		t.Errorf("Expected %v, got %v", ContentTypeSSE, stream.ContentType())
+	}
+	stream.Record(map[string]string{"name": "Infosys Ltd"})
+	stream.Close(nil)
+
+	expected := "id: 1\nevent: record\ndata: {\"name\":\"Infosys Ltd\"}\n\n" +
+		"id: 2\nevent: done\ndata: {\"status\":\"ok\",\"records\":1,\"summaries\":0,\"warnings\":0,\"errors\":0}\n\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestStream_Status(t *testing.T) {
+	tests := []struct {
+		name     string
+		warnings int
+		err      error
+		expected string
+	}{
+		{"ok", 0, nil, StatusOK},
+		{"partial", 2, nil, StatusPartial},
+		{"failed", 1, errors.New("workbook is encrypted"), StatusFailed},
+	}
+	for _, test := range tests {
+		var out buffer
+		stream := NewStream(&out, FormatNDJSON)
+		for i := 0; i < test.warnings; i++ {
+			stream.Warning(Notice{Code: "skipped_sheet", Message: "no known holdings header"})
+		}
+		stream.Close(test.err)
+		if done := stream.Done(); done.Status != test.expected || done.Warnings != test.warnings {
+			t.Errorf("Expected %v with %d warnings for %s, got %+v", test.expected, test.warnings, test.name, done)
+		}
+		if test.err != nil && !strings.Contains(out.String(), `"type":"error"`) {
+			t.Errorf("Expected an error event for %s, got %v", test.name, out.String())
+		}
+	}
+}
+
+func TestStream_WriteError(t *testing.T) {
+	stream := NewStream(brokenWriter{}, FormatNDJSON)
+	if err := stream.Record("first"); err == nil {
+		t.Fatalf("Expected a write error")
+	}
+	if err := stream.Record("second"); err == nil || stream.Err() == nil {
+		t.Errorf("Expected the write error to stick, got %v", err)
+	}
+
+	var out buffer
+	stream = NewStream(&out, FormatNDJSON)
+	stream.Close(nil)
+	if err := stream.Record("late"); err == nil {
+		t.Errorf("Expected an error for an event after done")
+	}
+}
+
+func TestStream_Deliver(t *testing.T) {
+	var out buffer
+	stream := NewStream(&out, FormatNDJSON)
+	if err := stream.Deliver(TypeRecord, func() {}); err != nil {
+		t.Errorf("Expected an unmarshallable event to be skipped, got %v", err)
+	}
+	if err := stream.Deliver(TypeRecord, "first"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if got := stream.Done().Records; got != 1 {
+		t.Errorf("Expected 1 record, got %v", got)
+	}
+
+	stream = NewStream(brokenWriter{}, FormatNDJSON)
+	if err := stream.Deliver(TypeRecord, "first"); err == nil {
+		t.Errorf("Expected an error once the client is gone")
+	}
+}
+
+func TestFormatFor(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", FormatNDJSON},
+		{"application/x-ndjson", FormatNDJSON},
+		{"text/event-stream", FormatSSE},
+		{"text/event-stream, */*;q=0.1", FormatSSE},
+	}
+	for _, test := range tests {
+		if got := FormatFor(test.accept); got != test.expected {
+			t.Errorf("Expected %v for %q, got %v", test.expected, test.accept, got)
+		}
+	}
+}
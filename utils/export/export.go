@@ -0,0 +1,325 @@
+// Package export builds the Excel workbook analysts download after an
+// upload is scored: every holding with its scores, and a summary per fund.
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"stockbackend/types"
+	"stockbackend/utils/events"
+	"stockbackend/utils/holdings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Sheet names of the exported workbook
+const (
+	HoldingsSheet = "Holdings"
+	SummarySheet  = "Summary"
+)
+
+// ContentType is the MIME type of the exported workbook
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Scheme is one analysed sheet: its scored holdings followed by its summary
+type Scheme struct {
+	Holdings []map[string]interface{}
+	Summary  types.PortfolioSummary
+}
+
+// maxLine caps a single NDJSON record; holdings are far smaller
+const maxLine = 4 << 20
+
+// ReadNDJSON groups the records streamed by an upload into schemes. Each
+// summary closes the scheme whose holdings came before it. Both the event
+// envelopes of the stream and the bare records of older job results are
+// read; other events and lines that are not JSON objects are skipped.
+func ReadNDJSON(r io.Reader) ([]Scheme, error) {
+	var schemes []Scheme
+	var pending []map[string]interface{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var envelope struct {
+			events.Envelope
+			Summary *types.PortfolioSummary `json:"summary"`
+		}
+		if err := json.Unmarshal(line, &envelope); err != nil {
+			return nil, err
+		}
+		switch {
+		case envelope.Type == events.TypeSummary:
+			var summary types.PortfolioSummary
+			if err := json.Unmarshal(envelope.Data, &summary); err != nil {
+				return nil, err
+			}
+			schemes = append(schemes, Scheme{Holdings: pending, Summary: summary})
+			pending = nil
+		case envelope.Type == events.TypeRecord:
+			var record map[string]interface{}
+			if err := json.Unmarshal(envelope.Data, &record); err != nil {
+				return nil, err
+			}
+			pending = append(pending, record)
+		case events.Known(envelope.Type):
+			continue
+		case envelope.Summary != nil:
+			schemes = append(schemes, Scheme{Holdings: pending, Summary: *envelope.Summary})
+			pending = nil
+		default:
+			var record map[string]interface{}
+			if err := json.Unmarshal(line, &record); err != nil {
+				return nil, err
+			}
+			pending = append(pending, record)
+		}
+	}
+	return schemes, scanner.Err()
+}
+
+// column is one column of the holdings sheet. Numeric columns hold the
+// number read from the disclosure rather than its text.
+type column struct {
+	title   string
+	field   string
+	numeric bool
+	width   float64
+}
+
+var holdingColumns = []column{
+	{title: "Scheme", field: "scheme", width: 36},
+	{title: holdings.FieldName, field: holdings.FieldName, width: 40},
+	{title: holdings.FieldISIN, field: holdings.FieldISIN, width: 15},
+	{title: holdings.FieldIndustry, field: holdings.FieldIndustry, width: 24},
+	{title: holdings.FieldQuantity, field: holdings.FieldQuantity, numeric: true, width: 14},
+	{title: holdings.FieldMarketValue, field: holdings.FieldMarketValue, numeric: true, width: 16},
+	{title: holdings.FieldWeight, field: holdings.FieldWeight, numeric: true, width: 12},
+	{title: "Asset Class", field: holdings.FieldAssetClass, width: 12},
+	{title: "Status", field: holdings.FieldStatus, width: 12},
+	{title: "Market Cap", field: holdings.FieldMarketCap, width: 12},
+	{title: "Stock Rate", field: holdings.FieldStockRate, numeric: true, width: 11},
+	{title: "Peer Comparison Score", field: "peerComparisonScore", numeric: true, width: 12},
+	{title: "Trend Score", field: "trendScore", numeric: true, width: 11},
+	{title: "F-Score", field: holdings.FieldFScore, numeric: true, width: 9},
+	{title: "Recommendation", field: "recommendation", width: 15},
+	{title: "Target Price", field: "targetPrice", numeric: true, width: 12},
+	{title: "Current Price", field: "currentPrice", numeric: true, width: 12},
+	{title: "Upside/Downside %", field: "upsideDownside", numeric: true, width: 12},
+	{title: "Match Confidence", field: holdings.FieldMatchConfidence, numeric: true, width: 11},
+	{title: "Unresolved Reason", field: "reason", width: 18},
+}
+
+// Workbook lays the schemes out on a holdings sheet and a summary sheet
+func Workbook(schemes []Scheme) (*excelize.File, error) {
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", HoldingsSheet); err != nil {
+		return nil, err
+	}
+	if _, err := f.NewSheet(SummarySheet); err != nil {
+		return nil, err
+	}
+	header, err := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#DDEBF7"}},
+		Alignment: &excelize.Alignment{WrapText: true, Vertical: "center"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeHoldings(f, header, schemes); err != nil {
+		return nil, err
+	}
+	if err := writeSummary(f, header, schemes); err != nil {
+		return nil, err
+	}
+	f.SetActiveSheet(0)
+	return f, nil
+}
+
+func writeHoldings(f *excelize.File, header int, schemes []Scheme) error {
+	titles := make([]interface{}, len(holdingColumns))
+	for i, col := range holdingColumns {
+		titles[i] = col.title
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		if err := f.SetColWidth(HoldingsSheet, name, name, col.width); err != nil {
+			return err
+		}
+	}
+	if err := writeRow(f, HoldingsSheet, 1, titles, header); err != nil {
+		return err
+	}
+
+	row := 2
+	for _, scheme := range schemes {
+		for _, stockDetail := range scheme.Holdings {
+			values := make([]interface{}, len(holdingColumns))
+			for i, col := range holdingColumns {
+				values[i] = cellValue(stockDetail[col.field], col.numeric)
+			}
+			if col := columnIndex("scheme"); values[col] == "" {
+				values[col] = scheme.Summary.Scheme
+			}
+			if err := writeRow(f, HoldingsSheet, row, values, 0); err != nil {
+				return err
+			}
+			row++
+		}
+	}
+
+	last, _ := excelize.ColumnNumberToName(len(holdingColumns))
+	if err := f.SetPanes(HoldingsSheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+	if err := f.AutoFilter(HoldingsSheet, fmt.Sprintf("A1:%s%d", last, max(row-1, 1)), nil); err != nil {
+		return err
+	}
+	if row > 2 {
+		return highlightHoldings(f, row-1)
+	}
+	return nil
+}
+
+// highlightHoldings colours the scores from red to green, the
+// recommendations by their call and the holdings that did not resolve
+func highlightHoldings(f *excelize.File, lastRow int) error {
+	green, err := f.NewConditionalStyle(&excelize.Style{Font: &excelize.Font{Color: "#006100"}, Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#C6EFCE"}}})
+	if err != nil {
+		return err
+	}
+	amber, err := f.NewConditionalStyle(&excelize.Style{Font: &excelize.Font{Color: "#9C5700"}, Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#FFEB9C"}}})
+	if err != nil {
+		return err
+	}
+	red, err := f.NewConditionalStyle(&excelize.Style{Font: &excelize.Font{Color: "#9C0006"}, Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#FFC7CE"}}})
+	if err != nil {
+		return err
+	}
+
+	rangeOf := func(field string) string {
+		name, _ := excelize.ColumnNumberToName(columnIndex(field) + 1)
+		return fmt.Sprintf("%s2:%s%d", name, name, lastRow)
+	}
+	colorScale := []excelize.ConditionalFormatOptions{{
+		Type:     "3_color_scale",
+		Criteria: "=",
+		MinType:  "min",
+		MidType:  "percentile",
+		MidValue: "50",
+		MaxType:  "max",
+		MinColor: "#F8696B",
+		MidColor: "#FFEB84",
+		MaxColor: "#63BE7B",
+	}}
+	for _, field := range []string{holdings.FieldStockRate, "peerComparisonScore", "trendScore", holdings.FieldFScore, "upsideDownside"} {
+		if err := f.SetConditionalFormat(HoldingsSheet, rangeOf(field), colorScale); err != nil {
+			return err
+		}
+	}
+	if err := f.SetConditionalFormat(HoldingsSheet, rangeOf("recommendation"), []excelize.ConditionalFormatOptions{
+		{Type: "cell", Criteria: "==", Value: `"BUY"`, Format: green},
+		{Type: "cell", Criteria: "==", Value: `"HOLD"`, Format: amber},
+		{Type: "cell", Criteria: "==", Value: `"SELL"`, Format: red},
+	}); err != nil {
+		return err
+	}
+	return f.SetConditionalFormat(HoldingsSheet, rangeOf(holdings.FieldStatus), []excelize.ConditionalFormatOptions{
+		{Type: "cell", Criteria: "==", Value: `"` + holdings.StatusUnresolved + `"`, Format: red},
+	})
+}
+
+func writeSummary(f *excelize.File, header int, schemes []Scheme) error {
+	titles := []interface{}{"Scheme", "Sheet", "AMC", "As Of", "Extraction", "Holdings", "Resolved", "Unresolved",
+		"Weighted Stock Rate", "Weighted F-Score", "Top 10 Equity Weight", "Total Weight", "Weight Covered", "Portfolio ID"}
+	if err := writeRow(f, SummarySheet, 1, titles, header); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(SummarySheet, "A", "A", 36); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(SummarySheet, "B", "N", 14); err != nil {
+		return err
+	}
+	row := 2
+	for _, scheme := range schemes {
+		s := scheme.Summary
+		values := []interface{}{s.Scheme, s.Sheet, s.Fund.AMC, s.Fund.AsOfDate, s.Extraction, s.Holdings, s.Resolved, s.Unresolved,
+			s.WeightedStockRate, s.WeightedFScore, s.Top10Weight, s.TotalWeight, s.WeightCovered, s.PortfolioID}
+		if err := writeRow(f, SummarySheet, row, values, 0); err != nil {
+			return err
+		}
+		row++
+	}
+
+	// Allocation by asset class and market cap, one line per fund and bucket
+	row++
+	if err := writeRow(f, SummarySheet, row, []interface{}{"Scheme", "Breakdown", "Bucket", "Holdings", "Weight"}, header); err != nil {
+		return err
+	}
+	row++
+	for _, scheme := range schemes {
+		for _, allocation := range scheme.Summary.Allocation {
+			if err := writeRow(f, SummarySheet, row, []interface{}{scheme.Summary.Scheme, "Asset class", allocation.AssetClass, allocation.Holdings, allocation.Weight}, 0); err != nil {
+				return err
+			}
+			row++
+		}
+		for _, bucket := range scheme.Summary.MarketCaps {
+			if err := writeRow(f, SummarySheet, row, []interface{}{scheme.Summary.Scheme, "Market cap", bucket.Category, bucket.Holdings, bucket.Weight}, 0); err != nil {
+				return err
+			}
+			row++
+		}
+	}
+	return nil
+}
+
+func writeRow(f *excelize.File, sheet string, row int, values []interface{}, style int) error {
+	cell, _ := excelize.CoordinatesToCellName(1, row)
+	if err := f.SetSheetRow(sheet, cell, &values); err != nil {
+		return err
+	}
+	if style == 0 {
+		return nil
+	}
+	last, _ := excelize.CoordinatesToCellName(len(values), row)
+	return f.SetCellStyle(sheet, cell, last, style)
+}
+
+func columnIndex(field string) int {
+	for i, col := range holdingColumns {
+		if col.field == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// cellValue turns a decoded JSON value into what the cell should hold.
+// Numeric columns read numbers out of disclosure text such as "1,234.5";
+// text that holds no number, like an F-Score "Not Available", is kept.
+func cellValue(value interface{}, numeric bool) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64, bool:
+		return v
+	case string:
+		if !numeric {
+			return v
+		}
+		if number := holdings.ParseNumber(v); number != 0 || (v != "" && strings.Trim(v, "0.,% ") == "") {
+			return number
+		}
+		return v
+	}
+	return fmt.Sprintf("%v", value)
+}
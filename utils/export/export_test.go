@@ -0,0 +1,109 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const stream = `{"Name of the Instrument":"Infosys Ltd","ISIN":"INE009A01021","Quantity":"1,20,000","Percentage of AUM":"6.55","assetClass":"equity","status":"resolved","marketCap":"Large Cap","stockRate":72.5,"fScore":7,"recommendation":"BUY","targetPrice":1890.5,"scheme":"Axis Bluechip Fund"}
+{"Name of the Instrument":"Unknown Co","Percentage of AUM":"0.00","assetClass":"equity","status":"unresolved","fScore":"Not Available","reason":"not_scraped","scheme":"Axis Bluechip Fund"}
+{"summary":{"scheme":"Axis Bluechip Fund","sheet":"AXISBF","fund":{"amc":"Axis Mutual Fund","asOfDate":"2024-03-31"},"extraction":"header","holdings":2,"resolved":1,"unresolved":1,"allocation":[{"assetClass":"equity","holdings":2,"weight":6.55}],"marketCaps":[{"category":"Large Cap","holdings":1,"weight":6.55}]}}
+{"Name of the Instrument":"HDFC Bank Ltd","Percentage of AUM":"9.1","assetClass":"equity","status":"resolved"}
+{"summary":{"scheme":"Axis Midcap Fund","sheet":"AXISMF","extraction":"header","holdings":1,"resolved":1}}
+
+Stream complete.
+`
+
+func TestReadNDJSON(t *testing.T) {
+	schemes, err := ReadNDJSON(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(schemes) != 2 {
+		t.Fatalf("Expected 2 schemes, got %v", len(schemes))
+	}
+	if len(schemes[0].Holdings) != 2 || schemes[0].Summary.Fund.AMC != "Axis Mutual Fund" {
+		t.Errorf("Expected 2 holdings of Axis Mutual Fund, got %v", schemes[0])
+	}
+	if len(schemes[1].Holdings) != 1 || schemes[1].Summary.Scheme != "Axis Midcap Fund" {
+		t.Errorf("Expected 1 holding of Axis Midcap Fund, got %v", schemes[1])
+	}
+}
+
+const eventStream = `{"type":"progress","seq":1,"data":{"done":0,"total":2,"sheet":"AXISBF"}}
+{"type":"record","seq":2,"data":{"Name of the Instrument":"Infosys Ltd","Percentage of AUM":"6.55","status":"resolved"}}
+{"type":"warning","seq":3,"data":{"code":"skipped_sheet","message":"no known holdings header","sheet":"Index"}}
+{"type":"record","seq":4,"data":{"Name of the Instrument":"Unknown Co","status":"unresolved"}}
+{"type":"summary","seq":5,"data":{"scheme":"Axis Bluechip Fund","sheet":"AXISBF","holdings":2,"resolved":1,"unresolved":1}}
+{"type":"done","seq":6,"data":{"status":"partial","records":2,"summaries":1,"warnings":1,"errors":0}}
+`
+
+func TestReadNDJSON_Events(t *testing.T) {
+	schemes, err := ReadNDJSON(strings.NewReader(eventStream))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(schemes) != 1 {
+		t.Fatalf("Expected 1 scheme, got %v", len(schemes))
+	}
+	if len(schemes[0].Holdings) != 2 || schemes[0].Summary.Scheme != "Axis Bluechip Fund" {
+		t.Errorf("Expected 2 holdings of Axis Bluechip Fund, got %v", schemes[0])
+	}
+	if name := schemes[0].Holdings[1]["Name of the Instrument"]; name != "Unknown Co" {
+		t.Errorf("Expected Unknown Co, got %v", name)
+	}
+}
+
+func TestWorkbook(t *testing.T) {
+	schemes, err := ReadNDJSON(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	f, err := Workbook(schemes)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if sheets := f.GetSheetList(); len(sheets) != 2 || sheets[0] != HoldingsSheet || sheets[1] != SummarySheet {
+		t.Fatalf("Expected Holdings and Summary sheets, got %v", sheets)
+	}
+	rows, _ := f.GetRows(HoldingsSheet)
+	if len(rows) != 4 {
+		t.Fatalf("Expected a header and 3 holdings, got %v rows", len(rows))
+	}
+	cell := func(row int, field string) string {
+		name, _ := excelize.CoordinatesToCellName(columnIndex(field)+1, row)
+		value, _ := f.GetCellValue(HoldingsSheet, name)
+		return value
+	}
+	tests := []struct {
+		row      int
+		field    string
+		expected string
+	}{
+		{2, "Quantity", "120000"},
+		{2, "recommendation", "BUY"},
+		{2, "targetPrice", "1890.5"},
+		{3, "Percentage of AUM", "0"},
+		{3, "fScore", "Not Available"},
+		{3, "reason", "not_scraped"},
+		{4, "scheme", "Axis Midcap Fund"},
+	}
+	for _, test := range tests {
+		if got := cell(test.row, test.field); got != test.expected {
+			t.Errorf("Expected %s of row %d to be %v, got %v", test.field, test.row, test.expected, got)
+		}
+	}
+
+	formats, _ := f.GetConditionalFormats(HoldingsSheet)
+	if len(formats) == 0 {
+		t.Errorf("Expected conditional formats on the holdings sheet")
+	}
+
+	summary, _ := f.GetRows(SummarySheet)
+	if len(summary) < 3 || summary[1][0] != "Axis Bluechip Fund" || summary[2][0] != "Axis Midcap Fund" {
+		t.Errorf("Expected a summary row per scheme, got %v", summary)
+	}
+}
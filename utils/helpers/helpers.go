@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -358,12 +359,18 @@ func ParsePeersTable(doc *goquery.Document, selector string) []map[string]string
 	return peers
 }
 
-func FetchPeerData(dataWarehouseID string) ([]map[string]string, error) {
-	time.Sleep(1 * time.Second)
+// FetchPeerData fetches the peers table of a company, waiting a second
+// first so the site is not hammered, unless ctx is cancelled
+func FetchPeerData(ctx context.Context, dataWarehouseID string) ([]map[string]string, error) {
+	select {
+	case <-time.After(1 * time.Second):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	peerURL := fmt.Sprintf(os.Getenv("COMPANY_URL")+"/api/company/%s/peers/", dataWarehouseID)
 
 	// Create a new HTTP request
-	req, err := http.NewRequest("GET", peerURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", peerURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request to peers API: %w", err)
 	}
@@ -512,10 +519,12 @@ func ParseTable(tableDiv *goquery.Selection) []map[string]interface{} {
 	return tableData
 }
 
-func FetchCompanyData(url string) (map[string]interface{}, error) {
-	body, err := http_client.GetCompanyPage(url)
+// FetchCompanyData scrapes a company page and its peers. The requests are
+// abandoned when ctx is cancelled.
+func FetchCompanyData(ctx context.Context, url string) (map[string]interface{}, error) {
+	body, err := http_client.GetCompanyPage(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch the company page: %v", err)
+		return nil, fmt.Errorf("failed to fetch the company page: %w", err)
 	}
 	defer body.Close()
 	// Parse the HTML content of the company page
@@ -528,7 +537,7 @@ func FetchCompanyData(url string) (map[string]interface{}, error) {
 
 	dataWarehouseID, exists := doc.Find("div[data-warehouse-id]").Attr("data-warehouse-id")
 	if exists {
-		peerData, err := FetchPeerData(dataWarehouseID)
+		peerData, err := FetchPeerData(ctx, dataWarehouseID)
 		if err == nil {
 			companyData["peers"] = peerData
 		}
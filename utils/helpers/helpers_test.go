@@ -1,10 +1,13 @@
 package helpers
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"stockbackend/types"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -144,12 +147,25 @@ func TestParseFloat_VariousInputs(t *testing.T) {
 }
 
 func TestFetchPeerData_HTTPError(t *testing.T) {
-	_, err := FetchPeerData("invalidID")
+	_, err := FetchPeerData(context.Background(), "invalidID")
 	if err == nil {
 		t.Errorf("Expected error, got nil")
 	}
 }
 
+func TestFetchPeerData_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	_, err := FetchPeerData(ctx, "invalidID")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected to return at once, took %v", elapsed)
+	}
+}
+
 func TestNormalizeString_NoSpaces(t *testing.T) {
 	input := "TESTSTRING"
 	expected := "teststring"
@@ -310,7 +326,7 @@ func TestNormalizeString_MixedCase(t *testing.T) {
 }
 
 func TestFetchPeerData_InvalidID(t *testing.T) {
-	_, err := FetchPeerData("invalidID")
+	_, err := FetchPeerData(context.Background(), "invalidID")
 	if err == nil {
 		t.Errorf("Expected error, got nil")
 	}
@@ -660,7 +676,7 @@ func TestGetNestedArrayField_KeysWithPlus(t *testing.T) {
 }
 
 func TestFetchCompanyData_InvalidURL(t *testing.T) {
-	_, err := FetchCompanyData("invalid-url")
+	_, err := FetchCompanyData(context.Background(), "invalid-url")
 	if err == nil {
 		t.Errorf("Expected error, got nil")
 	}
@@ -0,0 +1,130 @@
+package holdings
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"stockbackend/types"
+	"strconv"
+	"strings"
+)
+
+// Asset classes a holding can be tagged with
+const (
+	AssetClassEquity      = "Equity"
+	AssetClassDebt        = "Debt"
+	AssetClassMoneyMarket = "Money Market"
+	AssetClassDerivatives = "Derivatives"
+	AssetClassCash        = "Cash"
+	AssetClassOthers      = "Others"
+)
+
+type classRule struct {
+	assetClass string
+	pattern    *regexp.Regexp
+}
+
+// sectionRules are checked in order, so the more specific money market and
+// derivative headings win over the generic debt and equity ones
+var sectionRules = []classRule{
+	{AssetClassDerivatives, regexp.MustCompile(`derivative|futures?\b|options?\b|\bswaps?\b`)},
+	{AssetClassMoneyMarket, regexp.MustCompile(`money\s*market|certificates?\s*of\s*deposit|commercial\s*paper|treasury\s*bill|t-?bills?\b|treps|tri-?party\s*repo|reverse\s*repo|\bcblo\b`)},
+	{AssetClassCash, regexp.MustCompile(`\bcash\b|net\s*receivables?|net\s*current\s*assets|net\s*payables?|margin|deposits?\b`)},
+	{AssetClassDebt, regexp.MustCompile(`\bdebt\b|bonds?\b|debentures?|\bncds?\b|government\s*securit|\bg-?secs?\b|state\s*development\s*loans?|\bsdls?\b|securiti[sz]ed|pass\s*through|fixed\s*income`)},
+	{AssetClassOthers, regexp.MustCompile(`\breits?\b|\binvits?\b|mutual\s*fund\s*units|units\s*of|\bothers?\b`)},
+	{AssetClassEquity, regexp.MustCompile(`equity|equities|\bshares\b`)},
+}
+
+// instrumentRules recognise holdings that belong to a class whatever
+// section they are listed under, like TREPS or net receivables rows under
+// an "Others" heading
+var instrumentRules = []classRule{
+	{AssetClassMoneyMarket, regexp.MustCompile(`treps|tri-?party\s*repo|reverse\s*repo|\bcblo\b`)},
+	{AssetClassCash, regexp.MustCompile(`net\s*receivables?|net\s*current\s*assets|net\s*payables?|^cash\b|cash\s*&|cash\s*and`)},
+}
+
+// ClassifySection maps a section heading of a disclosure sheet to an asset class
+func ClassifySection(heading string) (string, bool) {
+	return classify(sectionRules, heading)
+}
+
+func classifyInstrument(name string) (string, bool) {
+	return classify(instrumentRules, name)
+}
+
+func classify(rules []classRule, text string) (string, bool) {
+	text = strings.ToLower(text)
+	for _, rule := range rules {
+		if rule.pattern.MatchString(text) {
+			return rule.assetClass, true
+		}
+	}
+	return "", false
+}
+
+// IsEquity reports whether a holding is an equity. Holdings read before
+// asset classes were tagged have none and count as equities.
+func IsEquity(stockDetail map[string]interface{}) bool {
+	assetClass, _ := stockDetail[FieldAssetClass].(string)
+	return assetClass == "" || assetClass == AssetClassEquity
+}
+
+// AllocationByAssetClass sums the %NAV of holdings per asset class, largest first
+func AllocationByAssetClass(holdings []map[string]interface{}) []types.Allocation {
+	byClass := make(map[string]*types.Allocation)
+	for _, stockDetail := range holdings {
+		assetClass, _ := stockDetail[FieldAssetClass].(string)
+		if assetClass == "" {
+			assetClass = AssetClassEquity
+		}
+		allocation, ok := byClass[assetClass]
+		if !ok {
+			allocation = &types.Allocation{AssetClass: assetClass}
+			byClass[assetClass] = allocation
+		}
+		allocation.Holdings++
+		allocation.Weight += Weight(stockDetail)
+	}
+
+	allocations := make([]types.Allocation, 0, len(byClass))
+	for _, allocation := range byClass {
+		allocation.Weight = round2(allocation.Weight)
+		allocations = append(allocations, *allocation)
+	}
+	sort.Slice(allocations, func(i, j int) bool {
+		if allocations[i].Weight == allocations[j].Weight {
+			return allocations[i].AssetClass < allocations[j].AssetClass
+		}
+		return allocations[i].Weight > allocations[j].Weight
+	})
+	return allocations
+}
+
+// Weight returns the %NAV of a holding as a number, 0 when it is missing
+func Weight(stockDetail map[string]interface{}) float64 {
+	value, _ := stockDetail[FieldWeight].(string)
+	return ParseNumber(value)
+}
+
+// ParseNumber reads numbers as they are printed in disclosures: with
+// thousands separators, a trailing % or negatives in brackets
+func ParseNumber(value string) float64 {
+	value = strings.TrimSpace(value)
+	value = strings.ReplaceAll(value, ",", "")
+	value = strings.ReplaceAll(value, "%", "")
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")")
+	value = strings.Trim(value, "()")
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	if negative {
+		return -number
+	}
+	return number
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
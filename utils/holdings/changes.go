@@ -0,0 +1,180 @@
+package holdings
+
+import (
+	"math"
+	"sort"
+	"stockbackend/types"
+	"stockbackend/utils/helpers"
+	"stockbackend/utils/names"
+	"strings"
+)
+
+// minWeightChange is the smallest %NAV move reported as an increase or
+// decrease; disclosures round weights to two decimals
+const minWeightChange = 0.01
+
+// Diff compares two disclosures of the same scheme. Holdings are matched by
+// ISIN, or by name for lines without one such as TREPS.
+func Diff(previous, current types.Portfolio) types.PortfolioChanges {
+	changes := types.PortfolioChanges{
+		SchemeName:   current.SchemeName,
+		AMC:          current.AMC,
+		PreviousDate: previous.AsOfDate,
+		CurrentDate:  current.AsOfDate,
+		Entries:      []types.HoldingChange{},
+		Exits:        []types.HoldingChange{},
+		Increased:    []types.HoldingChange{},
+		Decreased:    []types.HoldingChange{},
+	}
+
+	before := byHoldingKey(previous.Holdings)
+	after := byHoldingKey(current.Holdings)
+	var bought, sold, weightBought, weightSold float64
+
+	for key, now := range after {
+		then, held := before[key]
+		change := holdingChange(then, now)
+		switch {
+		case !held:
+			changes.Entries = append(changes.Entries, change)
+		case change.WeightChange >= minWeightChange:
+			changes.Increased = append(changes.Increased, change)
+		case change.WeightChange <= -minWeightChange:
+			changes.Decreased = append(changes.Decreased, change)
+		default:
+			changes.Unchanged++
+		}
+		value := tradedValue(then, now)
+		if value > 0 {
+			bought += value
+		} else {
+			sold -= value
+		}
+		if change.WeightChange > 0 {
+			weightBought += change.WeightChange
+		} else {
+			weightSold -= change.WeightChange
+		}
+	}
+	for key, then := range before {
+		if _, held := after[key]; held {
+			continue
+		}
+		change := holdingChange(then, types.PortfolioHolding{})
+		changes.Exits = append(changes.Exits, change)
+		sold -= tradedValue(then, types.PortfolioHolding{})
+		weightSold -= change.WeightChange
+	}
+
+	// Turnover from traded value needs quantities and market values; fall
+	// back to %NAV moves when the disclosures lack them
+	averageValue := (totalValue(previous.Holdings) + totalValue(current.Holdings)) / 2
+	if averageValue > 0 && (bought > 0 || sold > 0) {
+		changes.Turnover = round2(math.Min(bought, sold) / averageValue * 100)
+	} else {
+		changes.Turnover = round2(math.Min(weightBought, weightSold))
+	}
+
+	for _, list := range [][]types.HoldingChange{changes.Entries, changes.Exits, changes.Increased, changes.Decreased} {
+		sort.Slice(list, func(i, j int) bool {
+			if math.Abs(list[i].WeightChange) == math.Abs(list[j].WeightChange) {
+				return list[i].Name < list[j].Name
+			}
+			return math.Abs(list[i].WeightChange) > math.Abs(list[j].WeightChange)
+		})
+	}
+	return changes
+}
+
+func byHoldingKey(lines []types.PortfolioHolding) map[string]types.PortfolioHolding {
+	keyed := make(map[string]types.PortfolioHolding, len(lines))
+	for _, line := range lines {
+		key := strings.ToUpper(strings.TrimSpace(line.ISIN))
+		if key == "" {
+			key = "name:" + names.Key(line.Name)
+		}
+		// A security listed twice (e.g. under two sections) counts once
+		if existing, ok := keyed[key]; ok {
+			line.Quantity += existing.Quantity
+			line.MarketValue += existing.MarketValue
+			line.Weight += existing.Weight
+		}
+		keyed[key] = line
+	}
+	return keyed
+}
+
+func holdingChange(then, now types.PortfolioHolding) types.HoldingChange {
+	line := now
+	if line.Name == "" {
+		line = then
+	}
+	return types.HoldingChange{
+		ISIN:             line.ISIN,
+		Name:             line.Name,
+		AssetClass:       line.AssetClass,
+		PreviousWeight:   round2(then.Weight),
+		CurrentWeight:    round2(now.Weight),
+		WeightChange:     round2(now.Weight - then.Weight),
+		PreviousQuantity: then.Quantity,
+		CurrentQuantity:  now.Quantity,
+		QuantityChange:   now.Quantity - then.Quantity,
+	}
+}
+
+// tradedValue prices the quantity change of a holding, positive for
+// purchases and negative for sales. Lines without quantities (cash, TREPS)
+// are not trades.
+func tradedValue(then, now types.PortfolioHolding) float64 {
+	price := unitPrice(now)
+	if price == 0 {
+		price = unitPrice(then)
+	}
+	return (now.Quantity - then.Quantity) * price
+}
+
+func unitPrice(line types.PortfolioHolding) float64 {
+	if line.Quantity == 0 {
+		return 0
+	}
+	return line.MarketValue / line.Quantity
+}
+
+func totalValue(lines []types.PortfolioHolding) float64 {
+	total := 0.0
+	for _, line := range lines {
+		total += line.MarketValue
+	}
+	return total
+}
+
+// PairSchemes matches the portfolios of two workbooks by scheme name. Two
+// single-scheme workbooks are always paired. Schemes found in only one of
+// the workbooks are returned as unmatched.
+func PairSchemes(previous, current []types.Portfolio) ([][2]types.Portfolio, []string) {
+	if len(previous) == 1 && len(current) == 1 {
+		return [][2]types.Portfolio{{previous[0], current[0]}}, nil
+	}
+
+	byScheme := make(map[string]types.Portfolio, len(previous))
+	for _, portfolio := range previous {
+		byScheme[helpers.NormalizeString(portfolio.SchemeName)] = portfolio
+	}
+	var pairs [][2]types.Portfolio
+	var unmatched []string
+	for _, portfolio := range current {
+		key := helpers.NormalizeString(portfolio.SchemeName)
+		if earlier, ok := byScheme[key]; ok {
+			pairs = append(pairs, [2]types.Portfolio{earlier, portfolio})
+			delete(byScheme, key)
+			continue
+		}
+		unmatched = append(unmatched, portfolio.SchemeName)
+	}
+	for _, portfolio := range previous {
+		if _, ok := byScheme[helpers.NormalizeString(portfolio.SchemeName)]; ok {
+			unmatched = append(unmatched, portfolio.SchemeName)
+		}
+	}
+	return pairs, unmatched
+}
@@ -0,0 +1,76 @@
+package holdings
+
+import (
+	"stockbackend/types"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	previous := types.Portfolio{AsOfDate: "2024-02-29", Holdings: []types.PortfolioHolding{
+		{Name: "HDFC Bank Limited", ISIN: "INE040A01034", Quantity: 100, MarketValue: 500, Weight: 50},
+		{Name: "Infosys Limited", ISIN: "INE009A01021", Quantity: 50, MarketValue: 300, Weight: 30},
+		{Name: "Wipro Limited", ISIN: "INE075A01022", Quantity: 40, MarketValue: 200, Weight: 20},
+	}}
+	current := types.Portfolio{SchemeName: "Test Fund", AsOfDate: "2024-03-31", Holdings: []types.PortfolioHolding{
+		{Name: "HDFC Bank Limited", ISIN: "ine040a01034", Quantity: 100, MarketValue: 500, Weight: 50},
+		{Name: "Infosys Limited", ISIN: "INE009A01021", Quantity: 25, MarketValue: 150, Weight: 15},
+		{Name: "TCS Limited", ISIN: "INE467B01029", Quantity: 10, MarketValue: 350, Weight: 35},
+	}}
+
+	changes := Diff(previous, current)
+	if changes.PreviousDate != "2024-02-29" || changes.CurrentDate != "2024-03-31" || changes.SchemeName != "Test Fund" {
+		t.Errorf("Expected scheme and dates to be carried over, got %+v", changes)
+	}
+	if len(changes.Entries) != 1 || changes.Entries[0].ISIN != "INE467B01029" || changes.Entries[0].CurrentWeight != 35 {
+		t.Errorf("Expected TCS as the only entry, got %v", changes.Entries)
+	}
+	if len(changes.Exits) != 1 || changes.Exits[0].Name != "Wipro Limited" || changes.Exits[0].QuantityChange != -40 {
+		t.Errorf("Expected Wipro as the only exit, got %v", changes.Exits)
+	}
+	if len(changes.Decreased) != 1 || changes.Decreased[0].WeightChange != -15 || changes.Decreased[0].QuantityChange != -25 {
+		t.Errorf("Expected Infosys decreased by 15, got %v", changes.Decreased)
+	}
+	if len(changes.Increased) != 0 || changes.Unchanged != 1 {
+		t.Errorf("Expected HDFC Bank unchanged, got %v and %d", changes.Increased, changes.Unchanged)
+	}
+	// Bought 350 of TCS, sold 150 of Infosys and 200 of Wipro, over an
+	// average portfolio value of 1000
+	if changes.Turnover != 35 {
+		t.Errorf("Expected turnover 35, got %v", changes.Turnover)
+	}
+}
+
+func TestDiff_WeightTurnoverWithoutQuantities(t *testing.T) {
+	previous := types.Portfolio{Holdings: []types.PortfolioHolding{
+		{Name: "TREPS", Weight: 5},
+		{Name: "HDFC Bank Limited", ISIN: "INE040A01034", Weight: 95},
+	}}
+	current := types.Portfolio{Holdings: []types.PortfolioHolding{
+		{Name: "treps", Weight: 2},
+		{Name: "HDFC Bank Limited", ISIN: "INE040A01034", Weight: 98},
+	}}
+	changes := Diff(previous, current)
+	if len(changes.Entries) != 0 || len(changes.Exits) != 0 {
+		t.Errorf("Expected lines without ISIN to match by name, got %+v", changes)
+	}
+	if changes.Turnover != 3 {
+		t.Errorf("Expected turnover 3, got %v", changes.Turnover)
+	}
+}
+
+func TestPairSchemes(t *testing.T) {
+	previous := []types.Portfolio{{SchemeName: "Alpha Fund"}, {SchemeName: "Beta Fund"}}
+	current := []types.Portfolio{{SchemeName: "BETA FUND"}, {SchemeName: "Gamma Fund"}}
+	pairs, unmatched := PairSchemes(previous, current)
+	if len(pairs) != 1 || pairs[0][0].SchemeName != "Beta Fund" || pairs[0][1].SchemeName != "BETA FUND" {
+		t.Errorf("Expected Beta Fund to be paired, got %v", pairs)
+	}
+	if len(unmatched) != 2 || unmatched[0] != "Gamma Fund" || unmatched[1] != "Alpha Fund" {
+		t.Errorf("Expected Gamma Fund and Alpha Fund unmatched, got %v", unmatched)
+	}
+
+	pairs, _ = PairSchemes(previous[:1], current[:1])
+	if len(pairs) != 1 {
+		t.Errorf("Expected single-scheme workbooks to be paired, got %v", pairs)
+	}
+}
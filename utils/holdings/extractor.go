@@ -0,0 +1,274 @@
+package holdings
+
+import (
+	"regexp"
+	"stockbackend/types"
+	"stockbackend/utils/helpers"
+	"strings"
+)
+
+// Keys of the stockDetail maps produced by the Extractor
+const (
+	FieldName        = "Name of the Instrument"
+	FieldISIN        = "ISIN"
+	FieldIndustry    = "Industry/Rating"
+	FieldQuantity    = "Quantity"
+	FieldMarketValue = "Market/Fair Value"
+	FieldWeight      = "Percentage of AUM"
+	FieldAssetClass  = "assetClass"
+	FieldSection     = "section"
+	FieldExtraction  = "extraction"
+)
+
+// Values of FieldExtraction, recording how a holding was read from its sheet
+const (
+	ExtractionHeader = "header"
+	ExtractionLLM    = "llm"
+)
+
+var (
+	totalRowPattern = regexp.MustCompile(`^(sub\s*-?\s*total|total)\b`)
+	grandTotalRow   = regexp.MustCompile(`^grand\s*total\b`)
+	notesRowPattern = regexp.MustCompile(`^notes?\b`)
+)
+
+// Extractor is fed a disclosure sheet one row at a time. It finds the
+// holdings header using the best matching HeaderProfile and then keeps one
+// stockDetail per holding row, tagging each with the asset class and name of the section
+// it appears under. Subtotal and total rows are skipped; extraction only
+// stops at the grand total or the notes below it.
+type Extractor struct {
+	profiles    *ProfileRegistry
+	profile     *HeaderProfile
+	skipRows    int
+	headerFound bool
+	headerMap   map[string]int
+	assetClass  string
+	mainSection string
+	subSection  string
+	titleRows   [][]string
+	holdings    []map[string]interface{}
+}
+
+// NewExtractor returns an Extractor using the built-in header profiles
+func NewExtractor() *Extractor {
+	return NewExtractorWithProfiles(DefaultProfiles())
+}
+
+// NewExtractorWithProfiles returns an Extractor that detects the header
+// with the given profiles
+func NewExtractorWithProfiles(profiles *ProfileRegistry) *Extractor {
+	return &Extractor{
+		profiles:   profiles,
+		headerMap:  make(map[string]int),
+		assetClass: AssetClassEquity,
+	}
+}
+
+// HeaderFound reports whether the holdings header has been seen
+func (e *Extractor) HeaderFound() bool {
+	return e.headerFound
+}
+
+// Profile returns the name of the header profile the sheet was read with
+func (e *Extractor) Profile() string {
+	if e.profile == nil {
+		return ""
+	}
+	return e.profile.Name
+}
+
+// Holdings returns the holdings extracted so far, in sheet order
+func (e *Extractor) Holdings() []map[string]interface{} {
+	return e.holdings
+}
+
+// AddRow consumes the next row and reports whether more rows are wanted
+func (e *Extractor) AddRow(row []string) bool {
+	if len(row) == 0 {
+		return true
+	}
+
+	if !e.headerFound {
+		if !e.findHeader(row) {
+			e.addTitleRow(row)
+		}
+		return true
+	}
+	if e.skipRows > 0 {
+		e.skipRows--
+		return true
+	}
+
+	first := helpers.NormalizeString(firstCell(row))
+	switch {
+	case first == "":
+		return true
+	case grandTotalRow.MatchString(first), notesRowPattern.MatchString(first), e.profile.stopsAt(first):
+		return false
+	case totalRowPattern.MatchString(first):
+		return true
+	}
+
+	stockDetail := make(map[string]interface{})
+
+	// Extract data using the header map
+	for key, idx := range e.headerMap {
+		if idx < len(row) {
+			stockDetail[key] = strings.TrimSpace(row[idx])
+		} else {
+			stockDetail[key] = ""
+		}
+	}
+
+	instrumentName, _ := stockDetail[FieldName].(string)
+	if !isHoldingRow(stockDetail) {
+		// Rows without an ISIN or any value are section headings
+		heading := instrumentName
+		if heading == "" {
+			heading = strings.TrimSpace(firstCell(row))
+		}
+		e.startSection(heading)
+		return true
+	}
+
+	assetClass := e.assetClass
+	if class, ok := classifyInstrument(instrumentName); ok {
+		assetClass = class
+	}
+	if weight, ok := stockDetail[FieldWeight].(string); ok {
+		stockDetail[FieldWeight] = e.profile.scaleWeight(weight)
+	}
+	stockDetail[FieldAssetClass] = assetClass
+	stockDetail[FieldSection] = e.section()
+	stockDetail[FieldExtraction] = ExtractionHeader
+	e.holdings = append(e.holdings, stockDetail)
+	return true
+}
+
+// InstrumentHoldings converts instruments extracted by the LLM into the
+// stockDetail maps the Extractor produces, marked as LLM-extracted
+func InstrumentHoldings(instruments []types.Instrument) []map[string]interface{} {
+	holdings := make([]map[string]interface{}, 0, len(instruments))
+	for _, instrument := range instruments {
+		name := strings.TrimSpace(instrument.Name)
+		if name == "" {
+			continue
+		}
+		assetClass := AssetClassEquity
+		if class, ok := classifyInstrument(name); ok {
+			assetClass = class
+		}
+		holdings = append(holdings, map[string]interface{}{
+			FieldName:        name,
+			FieldISIN:        strings.TrimSpace(instrument.Isin),
+			FieldIndustry:    strings.TrimSpace(instrument.Industry),
+			FieldQuantity:    strings.TrimSpace(instrument.Quantity),
+			FieldMarketValue: strings.TrimSpace(instrument.MarketValue),
+			FieldWeight:      strings.TrimSpace(instrument.Percentage),
+			FieldAssetClass:  assetClass,
+			FieldSection:     "",
+			FieldExtraction:  ExtractionLLM,
+		})
+	}
+	return holdings
+}
+
+// Instruments converts the equity holdings among stockDetails back into
+// instruments, the form the fund comparison works with
+func Instruments(stockDetails []map[string]interface{}) []types.Instrument {
+	instruments := make([]types.Instrument, 0, len(stockDetails))
+	for _, stockDetail := range stockDetails {
+		text := func(key string) string {
+			value, _ := stockDetail[key].(string)
+			return value
+		}
+		if !IsEquity(stockDetail) {
+			continue
+		}
+		instruments = append(instruments, types.Instrument{
+			Name:        text(FieldName),
+			Isin:        text(FieldISIN),
+			Industry:    text(FieldIndustry),
+			Quantity:    text(FieldQuantity),
+			MarketValue: text(FieldMarketValue),
+			Percentage:  text(FieldWeight),
+		})
+	}
+	return instruments
+}
+
+func (e *Extractor) findHeader(row []string) bool {
+	var title []string
+	for _, titleRow := range e.titleRows {
+		title = append(title, joinCells(titleRow))
+	}
+	profile, headerMap := e.profiles.Detect(row, strings.Join(title, " "))
+	if profile == nil {
+		return false
+	}
+	e.headerFound = true
+	e.profile = profile
+	e.headerMap = headerMap
+	e.skipRows = profile.Layout.SkipRowsAfterHeader
+	return true
+}
+
+// startSection handles a heading row. Headings naming a new asset class
+// open a new section; anything else ("(a) Listed / awaiting listing ...",
+// "Treasury Bill" under money market) is a sub-section of the current one.
+func (e *Extractor) startSection(heading string) {
+	if heading == "" || strings.EqualFold(heading, "nil") {
+		return
+	}
+	if class, ok := ClassifySection(heading); ok && (class != e.assetClass || e.mainSection == "") {
+		e.assetClass = class
+		e.mainSection = heading
+		e.subSection = ""
+		return
+	}
+	e.subSection = heading
+}
+
+func (e *Extractor) section() string {
+	switch {
+	case e.mainSection == "":
+		return e.subSection
+	case e.subSection == "":
+		return e.mainSection
+	}
+	return e.mainSection + " - " + e.subSection
+}
+
+// isHoldingRow reports whether a row describes an instrument rather than a
+// heading: it needs a name and an ISIN, a weight or a market value
+func isHoldingRow(stockDetail map[string]interface{}) bool {
+	name, _ := stockDetail[FieldName].(string)
+	if name == "" || strings.EqualFold(name, "nil") {
+		return false
+	}
+	if isin, _ := stockDetail[FieldISIN].(string); isin != "" {
+		return true
+	}
+	for _, key := range []string{FieldWeight, FieldMarketValue} {
+		if value, _ := stockDetail[key].(string); isNumeric(value) {
+			return true
+		}
+	}
+	return false
+}
+
+var numericPattern = regexp.MustCompile(`^\(?-?[\d,]*\.?\d+\)?%?$`)
+
+func isNumeric(value string) bool {
+	return numericPattern.MatchString(strings.ReplaceAll(strings.TrimSpace(value), " ", ""))
+}
+
+func firstCell(row []string) string {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return cell
+		}
+	}
+	return ""
+}
@@ -0,0 +1,204 @@
+package holdings
+
+import (
+	"reflect"
+	"stockbackend/types"
+	"testing"
+)
+
+func sampleDisclosure() [][]string {
+	return [][]string{
+		{"", "HDFC Flexi Cap Fund"},
+		{"", "Portfolio as on 31-Mar-2024"},
+		{},
+		{"", "Name of the Instrument", "ISIN", "Industry / Rating", "Quantity", "Market/Fair Value (Rs. in Lacs.)", "% to NAV"},
+		{"", "EQUITY & EQUITY RELATED"},
+		{"", "(a) Listed / awaiting listing on Stock Exchanges"},
+		{"", "HDFC Bank Limited", "INE040A01034", "Banks", "1,000", "1,450.25", "6.50%"},
+		{"", "Infosys Limited", "INE009A01021", "IT - Software", "500", "720.10", "3.25%"},
+		{"", "Sub Total", "", "", "", "2,170.35", "9.75%"},
+		{"", "(b) Unlisted"},
+		{"", "NIL"},
+		{"", "Sub Total"},
+		{"", "Total", "", "", "", "2,170.35", "9.75%"},
+		{"", "DEBT INSTRUMENTS"},
+		{"", "(a) Listed / awaiting listing on Stock Exchanges"},
+		{"", "7.10% GOI 2034", "IN0020230085", "Sovereign", "100000", "101.20", "0.45%"},
+		{"", "Total", "", "", "", "101.20", "0.45%"},
+		{"", "MONEY MARKET INSTRUMENTS"},
+		{"", "TREPS - Tri-party Repo", "", "", "", "400.00", "1.80%"},
+		{"", "Total", "", "", "", "400.00", "1.80%"},
+		{"", "OTHERS"},
+		{"", "Net Receivables / (Payables)", "", "", "", "(20.00)", "(0.09)%"},
+		{"", "GRAND TOTAL (AUM)", "", "", "", "2,651.55", "100.00%"},
+		{"", "Should be ignored", "INE000000000", "", "", "1", "1%"},
+	}
+}
+
+func extract(rows [][]string) *Extractor {
+	extractor := NewExtractor()
+	for _, row := range rows {
+		if !extractor.AddRow(row) {
+			break
+		}
+	}
+	return extractor
+}
+
+func TestExtractor_KeepsGoingPastSubtotals(t *testing.T) {
+	extractor := extract(sampleDisclosure())
+	if !extractor.HeaderFound() {
+		t.Fatalf("Expected header to be found")
+	}
+
+	expected := []struct {
+		name       string
+		assetClass string
+		section    string
+	}{
+		{"HDFC Bank Limited", AssetClassEquity, "EQUITY & EQUITY RELATED - (a) Listed / awaiting listing on Stock Exchanges"},
+		{"Infosys Limited", AssetClassEquity, "EQUITY & EQUITY RELATED - (a) Listed / awaiting listing on Stock Exchanges"},
+		{"7.10% GOI 2034", AssetClassDebt, "DEBT INSTRUMENTS - (a) Listed / awaiting listing on Stock Exchanges"},
+		{"TREPS - Tri-party Repo", AssetClassMoneyMarket, "MONEY MARKET INSTRUMENTS"},
+		{"Net Receivables / (Payables)", AssetClassCash, "OTHERS"},
+	}
+
+	got := extractor.Holdings()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d holdings, got %d: %v", len(expected), len(got), got)
+	}
+	for i, want := range expected {
+		if got[i][FieldName] != want.name {
+			t.Errorf("Expected name %v, got %v", want.name, got[i][FieldName])
+		}
+		if got[i][FieldAssetClass] != want.assetClass {
+			t.Errorf("Expected asset class %v for %v, got %v", want.assetClass, want.name, got[i][FieldAssetClass])
+		}
+		if got[i][FieldSection] != want.section {
+			t.Errorf("Expected section %v for %v, got %v", want.section, want.name, got[i][FieldSection])
+		}
+		if got[i][FieldExtraction] != ExtractionHeader {
+			t.Errorf("Expected extraction %v for %v, got %v", ExtractionHeader, want.name, got[i][FieldExtraction])
+		}
+	}
+}
+
+func TestExtractor_NoHeader(t *testing.T) {
+	extractor := extract([][]string{
+		{"Some title"},
+		{"HDFC Bank Limited", "INE040A01034", "6.50%"},
+	})
+	if extractor.HeaderFound() {
+		t.Errorf("Expected no header")
+	}
+	if len(extractor.Holdings()) != 0 {
+		t.Errorf("Expected no holdings, got %v", extractor.Holdings())
+	}
+}
+
+func TestExtractor_KeepsDisclosedName(t *testing.T) {
+	extractor := extract([][]string{
+		{"Name of Instrument", "ISIN", "% to Net Assets"},
+		{"KEC International Limited", "INE389H01022", "1.2"},
+	})
+	holdings := extractor.Holdings()
+	if len(holdings) != 1 || holdings[0][FieldName] != "KEC International Limited" {
+		t.Errorf("Expected name as disclosed, got %v", holdings)
+	}
+}
+
+func TestClassifySection(t *testing.T) {
+	tests := []struct {
+		heading  string
+		expected string
+	}{
+		{"Equity & Equity related", AssetClassEquity},
+		{"Debt Instruments", AssetClassDebt},
+		{"Government Securities", AssetClassDebt},
+		{"Money Market Instruments", AssetClassMoneyMarket},
+		{"Certificate of Deposit", AssetClassMoneyMarket},
+		{"Commercial Paper", AssetClassMoneyMarket},
+		{"Index Futures", AssetClassDerivatives},
+		{"Derivatives", AssetClassDerivatives},
+		{"Cash & Cash Equivalents", AssetClassCash},
+		{"REITs & InvITs", AssetClassOthers},
+	}
+	for _, test := range tests {
+		result, ok := ClassifySection(test.heading)
+		if !ok || result != test.expected {
+			t.Errorf("Expected %v for %q, got %v", test.expected, test.heading, result)
+		}
+	}
+
+	if _, ok := ClassifySection("(a) Listed / awaiting listing on Stock Exchanges"); ok {
+		t.Errorf("Expected listing sub-heading not to be classified")
+	}
+}
+
+func TestAllocationByAssetClass(t *testing.T) {
+	allocation := AllocationByAssetClass(extract(sampleDisclosure()).Holdings())
+	expected := []types.Allocation{
+		{AssetClass: AssetClassEquity, Holdings: 2, Weight: 9.75},
+		{AssetClass: AssetClassMoneyMarket, Holdings: 1, Weight: 1.8},
+		{AssetClass: AssetClassDebt, Holdings: 1, Weight: 0.45},
+		{AssetClass: AssetClassCash, Holdings: 1, Weight: -0.09},
+	}
+	if len(allocation) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, allocation)
+	}
+	for i := range expected {
+		if allocation[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], allocation[i])
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1,450.25", 1450.25},
+		{"6.50%", 6.5},
+		{"(0.09)%", -0.09},
+		{"", 0},
+		{"abc", 0},
+	}
+	for _, test := range tests {
+		if result := ParseNumber(test.input); result != test.expected {
+			t.Errorf("Expected %v for %q, got %v", test.expected, test.input, result)
+		}
+	}
+}
+
+func TestInstrumentHoldings(t *testing.T) {
+	holdings := InstrumentHoldings([]types.Instrument{
+		{Name: "HDFC Bank Limited", Isin: "INE040A01034", Percentage: "6.50"},
+		{Name: " "},
+		{Name: "TREPS", Percentage: "1.80"},
+	})
+	if len(holdings) != 2 {
+		t.Fatalf("Expected 2 holdings, got %v", holdings)
+	}
+	if holdings[0][FieldExtraction] != ExtractionLLM || holdings[0][FieldAssetClass] != AssetClassEquity {
+		t.Errorf("Expected LLM-extracted equity, got %v", holdings[0])
+	}
+	if holdings[1][FieldAssetClass] != AssetClassMoneyMarket {
+		t.Errorf("Expected %v, got %v", AssetClassMoneyMarket, holdings[1][FieldAssetClass])
+	}
+}
+
+func TestInstruments(t *testing.T) {
+	instruments := Instruments([]map[string]interface{}{
+		{FieldName: "HDFC Bank Limited", FieldISIN: "INE040A01034", FieldIndustry: "Banks", FieldQuantity: "1,000", FieldWeight: "6.50", FieldAssetClass: AssetClassEquity},
+		{FieldName: "7.18% GOI 2033", FieldISIN: "IN0020230036", FieldWeight: "2.10", FieldAssetClass: AssetClassDebt},
+		{FieldName: "Infosys Ltd", FieldWeight: "4.25"},
+	})
+	expected := []types.Instrument{
+		{Name: "HDFC Bank Limited", Isin: "INE040A01034", Industry: "Banks", Quantity: "1,000", Percentage: "6.50"},
+		{Name: "Infosys Ltd", Percentage: "4.25"},
+	}
+	if !reflect.DeepEqual(instruments, expected) {
+		t.Errorf("Expected %v, got %v", expected, instruments)
+	}
+}
@@ -0,0 +1,185 @@
+package holdings
+
+import (
+	"regexp"
+	"stockbackend/types"
+	"stockbackend/utils/constants"
+	"strings"
+	"time"
+)
+
+// FundInfoSourceSheet marks fund details read from the sheet's title rows
+const FundInfoSourceSheet = "sheet"
+
+// maxTitleRows caps how many rows above the header are kept for the
+// fund name and date lookup
+const maxTitleRows = 30
+
+var (
+	asOfPattern       = regexp.MustCompile(`(?i)\bas\s*(?:on|at|of)\b\s*:?\s*(.+)`)
+	ordinalPattern    = regexp.MustCompile(`(?i)\b(\d{1,2})(st|nd|rd|th)\b`)
+	amcPattern        = regexp.MustCompile(`(?i)^(.*?\S)\s+mutual\s+fund\b`)
+	amcCompanyPattern = regexp.MustCompile(`(?i)^(.*?\S)\s+(asset\s+management|amc\b|investment\s+managers?)`)
+	schemePattern     = regexp.MustCompile(`(?i)\b(fund|scheme|etf|fof|plan)\b`)
+	schemeLabel       = regexp.MustCompile(`(?i)^(scheme\s*name|name\s*of\s*(the)?\s*scheme|fund\s*name)\s*[:\-]?\s*`)
+	portfolioPrefix   = regexp.MustCompile(`(?i)^(monthly\s+|half[\s-]*yearly\s+|fortnightly\s+)?portfolio\s*(statement|disclosure)?\s*(of|for)?\s*(the\s+)?(scheme\s*:?)?\s*`)
+	asOfSuffix        = regexp.MustCompile(`(?i)\s*[,\-–(]?\s*\bas\s*(on|at|of)\b.*$`)
+	openEndedSuffix   = regexp.MustCompile(`(?i)\s*\((an?\s+)?(open|close)[\s-]*ended.*$`)
+)
+
+// dateLayouts are the ways disclosures print their "as on" date
+var dateLayouts = []string{
+	"02-Jan-2006",
+	"2-Jan-2006",
+	"02-Jan-06",
+	"02 Jan 2006",
+	"2 Jan 2006",
+	"02 January 2006",
+	"2 January 2006",
+	"January 02 2006",
+	"January 2 2006",
+	"Jan 02 2006",
+	"Jan 2 2006",
+	"02/01/2006",
+	"2/1/2006",
+	"02.01.2006",
+	"02-01-2006",
+	"2006-01-02",
+	"January 2006",
+	"Jan 2006",
+}
+
+// TitleRows returns the rows seen above the holdings header
+func (e *Extractor) TitleRows() [][]string {
+	return e.titleRows
+}
+
+// FundInfo reads the scheme name, AMC and "as on" date from the title rows
+func (e *Extractor) FundInfo() types.FundInfo {
+	return ExtractFundInfo(e.titleRows)
+}
+
+func (e *Extractor) addTitleRow(row []string) {
+	if len(e.titleRows) < maxTitleRows {
+		e.titleRows = append(e.titleRows, row)
+	}
+}
+
+// ExtractFundInfo finds the scheme name, AMC and portfolio date in the
+// title rows above the holdings of a disclosure sheet
+func ExtractFundInfo(titleRows [][]string) types.FundInfo {
+	var info types.FundInfo
+	for _, row := range titleRows {
+		line := joinCells(row)
+		if line == "" {
+			continue
+		}
+
+		if info.AsOfDate == "" {
+			if match := asOfPattern.FindStringSubmatch(line); match != nil {
+				info.AsOfDate = ParseDisclosureDate(match[1])
+			}
+		}
+
+		// "SBI Mutual Fund - SBI Bluechip Fund" names both the fund house
+		// and the scheme; only the rest of the line can name the scheme
+		rest := line
+		if match := amcPattern.FindStringSubmatch(line); match != nil && !schemePattern.MatchString(match[1]) {
+			if info.AMC == "" {
+				info.AMC = cleanTitle(match[1]) + " Mutual Fund"
+			}
+			rest = line[len(match[0]):]
+		} else if match := amcCompanyPattern.FindStringSubmatch(line); match != nil {
+			if info.AMC == "" {
+				info.AMC = cleanTitle(match[1]) + " Mutual Fund"
+			}
+			continue
+		}
+
+		if info.SchemeName == "" {
+			info.SchemeName = schemeName(rest)
+		}
+	}
+
+	if info.AMC == "" {
+		info.AMC = AMCForScheme(info.SchemeName)
+	}
+	if info.SchemeName != "" || info.AMC != "" || info.AsOfDate != "" {
+		info.Source = FundInfoSourceSheet
+	}
+	return info
+}
+
+// schemeName returns the scheme a title line names, or "" if it names none
+func schemeName(line string) string {
+	name := schemeLabel.ReplaceAllString(line, "")
+	name = portfolioPrefix.ReplaceAllString(name, "")
+	name = asOfSuffix.ReplaceAllString(name, "")
+	name = openEndedSuffix.ReplaceAllString(name, "")
+	name = cleanTitle(name)
+	if name == "" || !schemePattern.MatchString(name) {
+		return ""
+	}
+	// "XYZ Mutual Fund" on its own is the fund house, not a scheme
+	if amcPattern.MatchString(name) && strings.HasSuffix(strings.ToLower(name), "mutual fund") {
+		return ""
+	}
+	return name
+}
+
+// AMCForScheme infers the fund house from the brand a scheme name starts with
+func AMCForScheme(scheme string) string {
+	lower := strings.ToLower(scheme)
+	for _, amc := range constants.AMCNames {
+		if strings.HasPrefix(lower, strings.ToLower(amc)+" ") {
+			return amc + " Mutual Fund"
+		}
+	}
+	return ""
+}
+
+// ParseDisclosureDate parses the date printed after "as on" and returns it
+// as YYYY-MM-DD, or "" when it is not a recognisable date. Month-only dates
+// resolve to the last day of that month.
+func ParseDisclosureDate(value string) string {
+	value = ordinalPattern.ReplaceAllString(strings.TrimSpace(value), "$1")
+	value = strings.Trim(value, " .:,()")
+	value = strings.Join(strings.Fields(strings.ReplaceAll(value, ",", " ")), " ")
+	for _, layout := range dateLayouts {
+		// Try the whole text, then just as many words as the layout has
+		for _, candidate := range []string{value, prefixWords(value, len(strings.Fields(layout)))} {
+			date, err := time.Parse(layout, candidate)
+			if err != nil {
+				continue
+			}
+			if layout == "January 2006" || layout == "Jan 2006" {
+				date = date.AddDate(0, 1, -1)
+			}
+			return date.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+func prefixWords(value string, words int) string {
+	fields := strings.Fields(value)
+	if len(fields) > words {
+		fields = fields[:words]
+	}
+	return strings.TrimRight(strings.Join(fields, " "), ".")
+}
+
+func joinCells(row []string) string {
+	var cells []string
+	for _, cell := range row {
+		if cell = strings.TrimSpace(cell); cell != "" {
+			cells = append(cells, cell)
+		}
+	}
+	return strings.Join(cells, " ")
+}
+
+func cleanTitle(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	return strings.Trim(value, " .:,-–")
+}
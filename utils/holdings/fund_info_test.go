@@ -0,0 +1,93 @@
+package holdings
+
+import (
+	"stockbackend/types"
+	"testing"
+)
+
+func TestExtractFundInfo(t *testing.T) {
+	tests := []struct {
+		name      string
+		titleRows [][]string
+		expected  types.FundInfo
+	}{
+		{
+			name: "separate AMC, scheme and date rows",
+			titleRows: [][]string{
+				{"", "HDFC Mutual Fund"},
+				{"", "HDFC Flexi Cap Fund (An open ended dynamic equity scheme investing across large cap, mid cap, small cap stocks)"},
+				{"", "Portfolio as on 31-Mar-2024"},
+			},
+			expected: types.FundInfo{SchemeName: "HDFC Flexi Cap Fund", AMC: "HDFC Mutual Fund", AsOfDate: "2024-03-31", Source: FundInfoSourceSheet},
+		},
+		{
+			name: "single statement line",
+			titleRows: [][]string{
+				{"Monthly Portfolio Statement of Axis Bluechip Fund as on March 31st, 2024"},
+			},
+			expected: types.FundInfo{SchemeName: "Axis Bluechip Fund", AMC: "Axis Mutual Fund", AsOfDate: "2024-03-31", Source: FundInfoSourceSheet},
+		},
+		{
+			name: "AMC and scheme on one line with date in its own cell",
+			titleRows: [][]string{
+				{"SBI Mutual Fund - SBI Bluechip Fund"},
+				{"Portfolio as on", "29/02/2024"},
+			},
+			expected: types.FundInfo{SchemeName: "SBI Bluechip Fund", AMC: "SBI Mutual Fund", AsOfDate: "2024-02-29", Source: FundInfoSourceSheet},
+		},
+		{
+			name: "scheme name label and asset management company",
+			titleRows: [][]string{
+				{"Kotak Mahindra Asset Management Company Limited"},
+				{"Scheme Name :", "Kotak Emerging Equity Fund"},
+				{"Portfolio as on June 2024"},
+			},
+			expected: types.FundInfo{SchemeName: "Kotak Emerging Equity Fund", AMC: "Kotak Mahindra Mutual Fund", AsOfDate: "2024-06-30", Source: FundInfoSourceSheet},
+		},
+		{
+			name:      "nothing recognisable",
+			titleRows: [][]string{{"Sheet1"}, {"(Rs. in Lakhs)"}},
+			expected:  types.FundInfo{},
+		},
+	}
+
+	for _, test := range tests {
+		result := ExtractFundInfo(test.titleRows)
+		if result != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestParseDisclosureDate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"31-Mar-2024", "2024-03-31"},
+		{"31-Mar-24", "2024-03-31"},
+		{"31st March, 2024", "2024-03-31"},
+		{"March 31, 2024", "2024-03-31"},
+		{"31.03.2024", "2024-03-31"},
+		{"2024-03-31", "2024-03-31"},
+		{"31-Mar-2024 (Unaudited)", "2024-03-31"},
+		{"February 2024", "2024-02-29"},
+		{"sometime soon", ""},
+	}
+	for _, test := range tests {
+		if result := ParseDisclosureDate(test.input); result != test.expected {
+			t.Errorf("Expected %v for %q, got %v", test.expected, test.input, result)
+		}
+	}
+}
+
+func TestExtractor_KeepsTitleRows(t *testing.T) {
+	extractor := extract(sampleDisclosure())
+	fund := extractor.FundInfo()
+	if fund.SchemeName != "HDFC Flexi Cap Fund" || fund.AsOfDate != "2024-03-31" || fund.AMC != "HDFC Mutual Fund" {
+		t.Errorf("Unexpected fund info %+v", fund)
+	}
+	if len(extractor.TitleRows()) != 2 {
+		t.Errorf("Expected 2 title rows, got %d", len(extractor.TitleRows()))
+	}
+}
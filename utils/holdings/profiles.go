@@ -0,0 +1,193 @@
+package holdings
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"stockbackend/utils/helpers"
+	"strconv"
+	"sync"
+)
+
+//go:embed header_profiles.json
+var defaultProfilesJSON []byte
+
+// headerFields is the order columns are claimed in when a header cell
+// matches more than one field
+var headerFields = []string{FieldName, FieldISIN, FieldIndustry, FieldQuantity, FieldMarketValue, FieldWeight}
+
+// HeaderProfile describes how one AMC lays out its holdings sheets
+type HeaderProfile struct {
+	Name string `json:"name"`
+	// AMCPatterns match the title rows of sheets published by this AMC
+	AMCPatterns []string `json:"amcPatterns,omitempty"`
+	// Headers maps each field to the header texts used for its column
+	Headers map[string][]string `json:"headers"`
+	Layout  ProfileLayout       `json:"layout,omitempty"`
+
+	amcPatterns []*regexp.Regexp
+	headers     map[string][]*regexp.Regexp
+	stops       []*regexp.Regexp
+}
+
+// ProfileLayout holds the sheet quirks of an AMC
+type ProfileLayout struct {
+	// SkipRowsAfterHeader ignores rows such as units lines right below the header
+	SkipRowsAfterHeader int `json:"skipRowsAfterHeader,omitempty"`
+	// WeightScale multiplies %NAV values, e.g. 100 when they are fractions
+	WeightScale float64 `json:"weightScale,omitempty"`
+	// StopPatterns end extraction when the first cell of a row matches
+	StopPatterns []string `json:"stopPatterns,omitempty"`
+}
+
+// ProfileRegistry is the set of known header profiles
+type ProfileRegistry struct {
+	Profiles []*HeaderProfile `json:"profiles"`
+}
+
+var (
+	defaultProfiles     *ProfileRegistry
+	defaultProfilesOnce sync.Once
+)
+
+// DefaultProfiles returns the profiles shipped with the service
+func DefaultProfiles() *ProfileRegistry {
+	defaultProfilesOnce.Do(func() {
+		registry, err := ParseProfiles(defaultProfilesJSON)
+		if err != nil {
+			panic(fmt.Sprintf("invalid embedded header profiles: %v", err))
+		}
+		defaultProfiles = registry
+	})
+	return defaultProfiles
+}
+
+// LoadProfiles reads a profile registry from a JSON file
+func LoadProfiles(path string) (*ProfileRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading header profiles: %w", err)
+	}
+	return ParseProfiles(data)
+}
+
+// ParseProfiles decodes and compiles a JSON profile registry
+func ParseProfiles(data []byte) (*ProfileRegistry, error) {
+	var registry ProfileRegistry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("error decoding header profiles: %w", err)
+	}
+	if len(registry.Profiles) == 0 {
+		return nil, fmt.Errorf("no header profiles defined")
+	}
+	for _, profile := range registry.Profiles {
+		if err := profile.compile(); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", profile.Name, err)
+		}
+	}
+	return &registry, nil
+}
+
+func (p *HeaderProfile) compile() error {
+	if len(p.Headers[FieldName]) == 0 {
+		return fmt.Errorf("no header patterns for %q", FieldName)
+	}
+	var err error
+	if p.amcPatterns, err = compileAll(p.AMCPatterns); err != nil {
+		return err
+	}
+	if p.stops, err = compileAll(p.Layout.StopPatterns); err != nil {
+		return err
+	}
+	p.headers = make(map[string][]*regexp.Regexp, len(p.Headers))
+	for field, patterns := range p.Headers {
+		if p.headers[field], err = compileAll(patterns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// mapHeader returns the column of every field found in a header row
+func (p *HeaderProfile) mapHeader(row []string) map[string]int {
+	headerMap := make(map[string]int)
+	for i, cell := range row {
+		normalizedHeader := helpers.NormalizeString(cell)
+		if normalizedHeader == "" {
+			continue
+		}
+		for _, field := range headerFields {
+			if _, mapped := headerMap[field]; mapped {
+				continue
+			}
+			if matchAny(p.headers[field], normalizedHeader) {
+				headerMap[field] = i
+				break
+			}
+		}
+	}
+	return headerMap
+}
+
+func (p *HeaderProfile) matchesAMC(title string) bool {
+	return matchAny(p.amcPatterns, title)
+}
+
+func (p *HeaderProfile) stopsAt(firstCell string) bool {
+	return matchAny(p.stops, firstCell)
+}
+
+// scaleWeight applies the profile's WeightScale to a %NAV value
+func (p *HeaderProfile) scaleWeight(value string) string {
+	if p.Layout.WeightScale == 0 || p.Layout.WeightScale == 1 || value == "" {
+		return value
+	}
+	return strconv.FormatFloat(ParseNumber(value)*p.Layout.WeightScale, 'f', -1, 64)
+}
+
+// Detect picks the profile that reads a row as a holdings header. A row is
+// a header when it has a name column and at least one other known column.
+// Profiles whose AMC appears in the title rows win, then the profile that
+// maps the most columns.
+func (r *ProfileRegistry) Detect(row []string, title string) (*HeaderProfile, map[string]int) {
+	var best *HeaderProfile
+	var bestMap map[string]int
+	bestScore := 0
+	for _, profile := range r.Profiles {
+		headerMap := profile.mapHeader(row)
+		if _, ok := headerMap[FieldName]; !ok || len(headerMap) < 2 {
+			continue
+		}
+		score := len(headerMap)
+		if profile.matchesAMC(title) {
+			score += len(headerFields)
+		}
+		if score > bestScore {
+			best, bestMap, bestScore = profile, headerMap, score
+		}
+	}
+	return best, bestMap
+}
+
+func matchAny(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package holdings
+
+import "testing"
+
+func TestExtractor_HeaderSynonyms(t *testing.T) {
+	extractor := extract([][]string{
+		{"ISIN", "Security Name", "Sector", "% to NAV"},
+		{"INE040A01034", "HDFC Bank Limited", "Banks", "6.50"},
+	})
+	if extractor.Profile() != "default" {
+		t.Errorf("Expected default profile, got %v", extractor.Profile())
+	}
+	holdings := extractor.Holdings()
+	if len(holdings) != 1 {
+		t.Fatalf("Expected 1 holding, got %v", holdings)
+	}
+	if holdings[0][FieldName] != "HDFC Bank Limited" || holdings[0][FieldISIN] != "INE040A01034" || holdings[0][FieldWeight] != "6.50" {
+		t.Errorf("Expected columns mapped by header, got %v", holdings[0])
+	}
+}
+
+func TestExtractor_DetectsAMCProfile(t *testing.T) {
+	extractor := extract([][]string{
+		{"ICICI Prudential Mutual Fund"},
+		{"Company/Issuer/Instrument Name", "ISIN", "Industry/Rating", "Quantity", "Exposure/Market Value(Rs.Lakh)", "% to Nav"},
+		{"HDFC Bank Limited", "INE040A01034", "Banks", "1000", "1450.25", "6.50%"},
+	})
+	if extractor.Profile() != "icici-prudential" {
+		t.Errorf("Expected icici-prudential profile, got %v", extractor.Profile())
+	}
+	holdings := extractor.Holdings()
+	if len(holdings) != 1 || holdings[0][FieldMarketValue] != "1450.25" {
+		t.Errorf("Expected exposure column as market value, got %v", holdings)
+	}
+}
+
+func TestExtractor_ProfileLayout(t *testing.T) {
+	profiles, err := ParseProfiles([]byte(`{"profiles": [{
+		"name": "fractions",
+		"headers": {
+			"Name of the Instrument": ["^issuer$"],
+			"Percentage of AUM": ["^weight$"]
+		},
+		"layout": {"skipRowsAfterHeader": 1, "weightScale": 100, "stopPatterns": ["^disclaimer"]}
+	}]}`))
+	if err != nil {
+		t.Fatalf("Expected profiles to parse, got %v", err)
+	}
+
+	extractor := NewExtractorWithProfiles(profiles)
+	for _, row := range [][]string{
+		{"Issuer", "Weight"},
+		{"(in fractions)", "0.5"},
+		{"HDFC Bank Limited", "0.065"},
+		{"Disclaimer", "1"},
+		{"Infosys Limited", "0.03"},
+	} {
+		if !extractor.AddRow(row) {
+			break
+		}
+	}
+	holdings := extractor.Holdings()
+	if len(holdings) != 1 {
+		t.Fatalf("Expected 1 holding, got %v", holdings)
+	}
+	if holdings[0][FieldWeight] != "6.5" {
+		t.Errorf("Expected weight 6.5, got %v", holdings[0][FieldWeight])
+	}
+}
+
+func TestParseProfiles_Invalid(t *testing.T) {
+	tests := []string{
+		`{"profiles": []}`,
+		`{"profiles": [{"name": "no-name", "headers": {"ISIN": ["isin"]}}]}`,
+		`{"profiles": [{"name": "bad", "headers": {"Name of the Instrument": ["("]}}]}`,
+		`not json`,
+	}
+	for _, test := range tests {
+		if _, err := ParseProfiles([]byte(test)); err == nil {
+			t.Errorf("Expected error for %s", test)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package holdings
+
+import (
+	"stockbackend/utils/helpers"
+	"strings"
+)
+
+// SchemeFilter picks schemes out of a multi-scheme workbook. A scheme is
+// picked when any term appears in its sheet or scheme name, ignoring case.
+// An empty filter picks every scheme.
+type SchemeFilter []string
+
+// ParseSchemeFilter builds a filter from query values, each of which may
+// hold several comma-separated terms
+func ParseSchemeFilter(values []string) SchemeFilter {
+	var filter SchemeFilter
+	for _, value := range values {
+		for _, term := range strings.Split(value, ",") {
+			if term = helpers.NormalizeString(term); term != "" {
+				filter = append(filter, term)
+			}
+		}
+	}
+	return filter
+}
+
+// Match reports whether any of the names is picked by the filter
+func (f SchemeFilter) Match(names ...string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, name := range names {
+		name = helpers.NormalizeString(name)
+		if name == "" {
+			continue
+		}
+		for _, term := range f {
+			if strings.Contains(name, term) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SchemeLabel is the name records of a sheet are grouped under: the scheme
+// name when the sheet has one, otherwise the sheet name
+func SchemeLabel(sheet, schemeName string) string {
+	if schemeName != "" {
+		return schemeName
+	}
+	return sheet
+}
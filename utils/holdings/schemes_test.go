@@ -0,0 +1,30 @@
+package holdings
+
+import "testing"
+
+func TestSchemeFilter(t *testing.T) {
+	filter := ParseSchemeFilter([]string{"flexi cap, Bluechip", " ", "ELSS"})
+	if len(filter) != 3 {
+		t.Fatalf("Expected 3 terms, got %v", filter)
+	}
+
+	tests := []struct {
+		names    []string
+		expected bool
+	}{
+		{[]string{"HDFCFCF", "HDFC Flexi Cap Fund"}, true},
+		{[]string{"SBI BLUECHIP", ""}, true},
+		{[]string{"Tax Saver (elss)", ""}, true},
+		{[]string{"HDFCMCF", "HDFC Mid-Cap Opportunities Fund"}, false},
+		{[]string{"", ""}, false},
+	}
+	for _, test := range tests {
+		if result := filter.Match(test.names...); result != test.expected {
+			t.Errorf("Expected %v for %v, got %v", test.expected, test.names, result)
+		}
+	}
+
+	if !ParseSchemeFilter(nil).Match("anything") {
+		t.Errorf("Expected an empty filter to match every scheme")
+	}
+}
@@ -0,0 +1,155 @@
+package holdings
+
+import (
+	"math"
+	"sort"
+	"stockbackend/types"
+	"strings"
+)
+
+// Keys the file service sets on equity holdings once they are matched
+const (
+	FieldStatus    = "status"
+	FieldMarketCap = "marketCap"
+	FieldStockRate = "stockRate"
+	FieldFScore    = "fScore"
+	FieldCompanyID = "companyId"
+	// FieldMatchConfidence is how sure the resolver is of the company, from 0 to 1
+	FieldMatchConfidence = "matchConfidence"
+	// FieldMatchConfirmed says whether the match is by ISIN, the security
+	// master or a confirmed alias rather than a name guess
+	FieldMatchConfirmed = "matchConfirmed"
+)
+
+// Values of FieldStatus
+const (
+	StatusResolved   = "resolved"
+	StatusUnresolved = "unresolved"
+)
+
+// topHoldings is how many of the largest equity holdings count towards the
+// concentration figure
+const topHoldings = 10
+
+// Summarize builds the fund-level figures of a sheet from its scored
+// holdings. Weighted scores are averaged over the %NAV of the holdings
+// that have the score.
+func Summarize(holdings []map[string]interface{}) types.PortfolioSummary {
+	summary := types.PortfolioSummary{
+		Holdings:   len(holdings),
+		Allocation: AllocationByAssetClass(holdings),
+		MarketCaps: []types.MarketCapBucket{},
+	}
+
+	buckets := make(map[string]*types.MarketCapBucket)
+	var weights []float64
+	var rate, rateWeight, fScore, fScoreWeight float64
+	for _, stockDetail := range holdings {
+		weight := Weight(stockDetail)
+		summary.TotalWeight += weight
+		// Concentration is about the stocks picked, not cash or debt lines
+		if IsEquity(stockDetail) {
+			weights = append(weights, weight)
+		}
+
+		switch stockDetail[FieldStatus] {
+		case StatusResolved:
+			summary.Resolved++
+			summary.WeightCovered += weight
+		case StatusUnresolved:
+			summary.Unresolved++
+		}
+
+		if category, ok := stockDetail[FieldMarketCap].(string); ok && category != "" {
+			bucket, ok := buckets[category]
+			if !ok {
+				bucket = &types.MarketCapBucket{Category: category}
+				buckets[category] = bucket
+			}
+			bucket.Holdings++
+			bucket.Weight += weight
+		}
+		if value, ok := score(stockDetail[FieldStockRate]); ok {
+			rate += value * weight
+			rateWeight += weight
+		}
+		if value, ok := score(stockDetail[FieldFScore]); ok {
+			fScore += value * weight
+			fScoreWeight += weight
+		}
+	}
+
+	for _, bucket := range buckets {
+		bucket.Weight = round2(bucket.Weight)
+		summary.MarketCaps = append(summary.MarketCaps, *bucket)
+	}
+	sort.Slice(summary.MarketCaps, func(i, j int) bool {
+		if summary.MarketCaps[i].Weight == summary.MarketCaps[j].Weight {
+			return summary.MarketCaps[i].Category < summary.MarketCaps[j].Category
+		}
+		return summary.MarketCaps[i].Weight > summary.MarketCaps[j].Weight
+	})
+
+	sort.Sort(sort.Reverse(sort.Float64Slice(weights)))
+	for i := 0; i < len(weights) && i < topHoldings; i++ {
+		summary.Top10Weight += weights[i]
+	}
+
+	if rateWeight > 0 {
+		summary.WeightedStockRate = round2(rate / rateWeight)
+	}
+	if fScoreWeight > 0 {
+		summary.WeightedFScore = round2(fScore / fScoreWeight)
+	}
+	summary.Top10Weight = round2(summary.Top10Weight)
+	summary.TotalWeight = round2(summary.TotalWeight)
+	summary.WeightCovered = round2(summary.WeightCovered)
+	return summary
+}
+
+// score reads a numeric score; fScore is "Not Available" when it could
+// not be computed
+func score(value interface{}) (float64, bool) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case int:
+		number = float64(v)
+	default:
+		return 0, false
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
+
+// PortfolioHoldings converts scored holdings into the lines of a stored
+// portfolio
+func PortfolioHoldings(stockDetails []map[string]interface{}) []types.PortfolioHolding {
+	lines := make([]types.PortfolioHolding, 0, len(stockDetails))
+	for _, stockDetail := range stockDetails {
+		text := func(key string) string {
+			value, _ := stockDetail[key].(string)
+			return value
+		}
+		assetClass := text(FieldAssetClass)
+		if assetClass == "" {
+			assetClass = AssetClassEquity
+		}
+		lines = append(lines, types.PortfolioHolding{
+			Name:        text(FieldName),
+			ISIN:        strings.ToUpper(text(FieldISIN)),
+			Industry:    text(FieldIndustry),
+			AssetClass:  assetClass,
+			Section:     text(FieldSection),
+			Quantity:    ParseNumber(text(FieldQuantity)),
+			MarketValue: ParseNumber(text(FieldMarketValue)),
+			Weight:      Weight(stockDetail),
+			Status:      text(FieldStatus),
+			CompanyID:   stockDetail[FieldCompanyID],
+		})
+	}
+	return lines
+}
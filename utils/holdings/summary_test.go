@@ -0,0 +1,78 @@
+package holdings
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	holdings := []map[string]interface{}{
+		{FieldWeight: "6.00", FieldStatus: StatusResolved, FieldMarketCap: "Large Cap", FieldStockRate: 80.0, FieldFScore: 7},
+		{FieldWeight: "4.00", FieldStatus: StatusResolved, FieldMarketCap: "Small Cap", FieldStockRate: 40.0, FieldFScore: "Not Available"},
+		{FieldWeight: "2.00", FieldStatus: StatusUnresolved},
+		{FieldWeight: "1.50", FieldAssetClass: AssetClassCash},
+	}
+	summary := Summarize(holdings)
+
+	if summary.Holdings != 4 || summary.Resolved != 2 || summary.Unresolved != 1 {
+		t.Errorf("Expected 4 holdings, 2 resolved and 1 unresolved, got %+v", summary)
+	}
+	if summary.WeightedStockRate != 64 {
+		t.Errorf("Expected weighted stock rate 64, got %v", summary.WeightedStockRate)
+	}
+	if summary.WeightedFScore != 7 {
+		t.Errorf("Expected weighted fScore 7, got %v", summary.WeightedFScore)
+	}
+	if summary.TotalWeight != 13.5 || summary.WeightCovered != 10 || summary.Top10Weight != 12 {
+		t.Errorf("Expected weights 13.5/10/12, got %v/%v/%v", summary.TotalWeight, summary.WeightCovered, summary.Top10Weight)
+	}
+	if len(summary.MarketCaps) != 2 || summary.MarketCaps[0].Category != "Large Cap" || summary.MarketCaps[0].Weight != 6 {
+		t.Errorf("Expected Large Cap first with weight 6, got %v", summary.MarketCaps)
+	}
+}
+
+func TestSummarize_TopTen(t *testing.T) {
+	var holdings []map[string]interface{}
+	for i := 1; i <= 12; i++ {
+		holdings = append(holdings, map[string]interface{}{FieldWeight: "1"})
+	}
+	holdings[5][FieldWeight] = "5"
+	summary := Summarize(holdings)
+	if summary.Top10Weight != 14 {
+		t.Errorf("Expected top 10 weight 14, got %v", summary.Top10Weight)
+	}
+	if summary.WeightedStockRate != 0 || len(summary.MarketCaps) != 0 {
+		t.Errorf("Expected no scores, got %+v", summary)
+	}
+}
+
+func TestSummarize_TopTenEquities(t *testing.T) {
+	holdings := []map[string]interface{}{
+		{FieldName: "TREPS", FieldWeight: "8.00", FieldAssetClass: AssetClassCash},
+		{FieldName: "Net Receivables / (Payables)", FieldWeight: "3.00", FieldAssetClass: AssetClassCash},
+		{FieldName: "7.26% GOI 2033", FieldWeight: "2.50", FieldAssetClass: AssetClassDebt},
+	}
+	for i := 1; i <= 11; i++ {
+		holdings = append(holdings, map[string]interface{}{FieldWeight: "2", FieldAssetClass: AssetClassEquity})
+	}
+	summary := Summarize(holdings)
+	if summary.Top10Weight != 20 {
+		t.Errorf("Expected top 10 weight 20 from equities only, got %v", summary.Top10Weight)
+	}
+	if summary.TotalWeight != 35.5 {
+		t.Errorf("Expected total weight 35.5, got %v", summary.TotalWeight)
+	}
+}
+
+func TestPortfolioHoldings(t *testing.T) {
+	lines := PortfolioHoldings([]map[string]interface{}{
+		{FieldName: "HDFC Bank Limited", FieldISIN: "ine040a01034", FieldQuantity: "1,000", FieldMarketValue: "1,450.25", FieldWeight: "6.50%", FieldStatus: StatusResolved, FieldCompanyID: "abc"},
+	})
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %v", lines)
+	}
+	line := lines[0]
+	if line.ISIN != "INE040A01034" || line.Quantity != 1000 || line.MarketValue != 1450.25 || line.Weight != 6.5 {
+		t.Errorf("Expected parsed numbers and ISIN, got %+v", line)
+	}
+	if line.AssetClass != AssetClassEquity || line.CompanyID != "abc" {
+		t.Errorf("Expected equity line linked to abc, got %+v", line)
+	}
+}
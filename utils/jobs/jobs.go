@@ -0,0 +1,180 @@
+// Package jobs runs work in the background on a fixed pool of workers and
+// keeps the status of every job for callers to poll, until the job has been
+// finished for longer than the retention.
+package jobs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"stockbackend/types"
+
+	"github.com/google/uuid"
+)
+
+// ErrQueueFull is returned by Submit when no more jobs can be queued
+var ErrQueueFull = errors.New("job queue is full")
+
+// DefaultRetention is how long a finished job is kept when JOB_RETENTION is
+// not set
+const DefaultRetention = 24 * time.Hour
+
+// resultExt is the extension of the NDJSON result files of jobs
+const resultExt = ".ndjson"
+
+// RetentionFromEnv reads JOB_RETENTION, a duration such as "6h"
+func RetentionFromEnv() time.Duration {
+	retention, err := time.ParseDuration(os.Getenv("JOB_RETENTION"))
+	if err != nil || retention <= 0 {
+		return DefaultRetention
+	}
+	return retention
+}
+
+// ResultPath is where the result of a job is written in dir
+func ResultPath(dir, id string) string {
+	return filepath.Join(dir, id+resultExt)
+}
+
+// Queue holds the jobs of this process. Jobs are only ever handed out as
+// copies, so a worker can update a job while callers read it.
+type Queue struct {
+	mu    sync.RWMutex
+	jobs  map[string]*types.Job
+	queue chan func()
+	once  sync.Once
+}
+
+// NewQueue returns a queue that holds up to size jobs waiting for a worker
+func NewQueue(size int) *Queue {
+	return &Queue{
+		jobs:  make(map[string]*types.Job),
+		queue: make(chan func(), size),
+	}
+}
+
+// Start launches the workers that drain the queue. Calling it more than
+// once has no effect.
+func (q *Queue) Start(workers int) {
+	q.once.Do(func() {
+		if workers < 1 {
+			workers = 1
+		}
+		for i := 0; i < workers; i++ {
+			go func() {
+				for run := range q.queue {
+					run()
+				}
+			}()
+		}
+	})
+}
+
+// Submit registers a new job and queues run with its ID. The job is
+// returned as it was queued, whatever the worker has done to it since.
+func (q *Queue) Submit(run func(id string)) (types.Job, error) {
+	now := time.Now()
+	job := &types.Job{
+		ID:        uuid.New().String(),
+		Status:    types.JobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	q.mu.Lock()
+	q.jobs[job.ID] = job
+	queued := *job
+	q.mu.Unlock()
+
+	select {
+	case q.queue <- func() { run(queued.ID) }:
+	default:
+		q.mu.Lock()
+		delete(q.jobs, queued.ID)
+		q.mu.Unlock()
+		return types.Job{}, ErrQueueFull
+	}
+	return queued, nil
+}
+
+// Get returns a copy of the job
+func (q *Queue) Get(id string) (types.Job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return types.Job{}, false
+	}
+	return *job, true
+}
+
+// Update changes the job under the lock
+func (q *Queue) Update(id string, fn func(job *types.Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok {
+		fn(job)
+		job.UpdatedAt = time.Now()
+	}
+}
+
+// Finish marks the job failed with err, or completed when err is nil
+func (q *Queue) Finish(id string, err error) {
+	q.Update(id, func(job *types.Job) {
+		if err != nil {
+			job.Status = types.JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = types.JobCompleted
+	})
+}
+
+// Expire forgets the jobs that finished before cutoff and returns their
+// IDs. Queued and running jobs are kept however old they are.
+func (q *Queue) Expire(cutoff time.Time) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var expired []string
+	for id, job := range q.jobs {
+		finished := job.Status == types.JobCompleted || job.Status == types.JobFailed
+		if finished && job.UpdatedAt.Before(cutoff) {
+			delete(q.jobs, id)
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
+
+// RemoveResults removes the result files in dir last written before cutoff
+// whose job is not known: those of expired jobs, and those left by jobs
+// from before a restart
+func RemoveResults(dir string, cutoff time.Time, known func(id string) bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), resultExt)
+		if !ok || entry.IsDir() || known(id) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+	return removed, nil
+}
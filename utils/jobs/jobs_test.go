@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"stockbackend/types"
+)
+
+// Run with -race: the workers update each job while Submit returns it
+func TestSubmit_Concurrent(t *testing.T) {
+	queue := NewQueue(100)
+	queue.Start(4)
+
+	var wg sync.WaitGroup
+	ids := make(chan string, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job, err := queue.Submit(func(id string) {
+				queue.Update(id, func(job *types.Job) { job.Status = types.JobRunning })
+				queue.Update(id, func(job *types.Job) { job.Done, job.Total = 1, 1 })
+				queue.Finish(id, nil)
+			})
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+				return
+			}
+			if job.Status != types.JobQueued || job.Done != 0 {
+				t.Errorf("Expected the job as it was queued, got %+v", job)
+			}
+			ids <- job.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	for id := range ids {
+		if _, ok := queue.Get(id); !ok {
+			t.Errorf("Expected job %v to be known", id)
+		}
+	}
+}
+
+func TestSubmit_QueueFull(t *testing.T) {
+	queue := NewQueue(1)
+	if _, err := queue.Submit(func(string) {}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	job, err := queue.Submit(func(string) {})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected %v, got %v", ErrQueueFull, err)
+	}
+	if _, ok := queue.Get(job.ID); ok {
+		t.Errorf("Expected the refused job to be forgotten")
+	}
+}
+
+func TestFinish(t *testing.T) {
+	queue := NewQueue(2)
+	done, _ := queue.Submit(func(string) {})
+	failed, _ := queue.Submit(func(string) {})
+	queue.Finish(done.ID, nil)
+	queue.Finish(failed.ID, errors.New("workbook is encrypted"))
+
+	if job, _ := queue.Get(done.ID); job.Status != types.JobCompleted {
+		t.Errorf("Expected %v, got %v", types.JobCompleted, job.Status)
+	}
+	if job, _ := queue.Get(failed.ID); job.Status != types.JobFailed || job.Error != "workbook is encrypted" {
+		t.Errorf("Expected a failed job with its error, got %+v", job)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	queue := NewQueue(3)
+	done, _ := queue.Submit(func(string) {})
+	failed, _ := queue.Submit(func(string) {})
+	running, _ := queue.Submit(func(string) {})
+	queue.Finish(done.ID, nil)
+	queue.Finish(failed.ID, errors.New("workbook is encrypted"))
+	queue.Update(running.ID, func(job *types.Job) { job.Status = types.JobRunning })
+
+	if expired := queue.Expire(time.Now().Add(-time.Hour)); len(expired) != 0 {
+		t.Errorf("Expected recent jobs to be kept, got %v", expired)
+	}
+	expired := queue.Expire(time.Now().Add(time.Second))
+	if len(expired) != 2 {
+		t.Fatalf("Expected the 2 finished jobs to expire, got %v", expired)
+	}
+	for _, id := range []string{done.ID, failed.ID} {
+		if _, ok := queue.Get(id); ok {
+			t.Errorf("Expected job %v to be forgotten", id)
+		}
+	}
+	if _, ok := queue.Get(running.ID); !ok {
+		t.Errorf("Expected the running job to be kept")
+	}
+}
+
+func TestRemoveResults(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"expired.ndjson", "known.ndjson", "recent.ndjson", "notes.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("{}\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if name != "recent.ndjson" {
+			os.Chtimes(path, old, old)
+		}
+	}
+
+	removed, err := RemoveResults(dir, time.Now().Add(-time.Hour), func(id string) bool { return id == "known" })
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"expired"}) {
+		t.Errorf("Expected %v, got %v", []string{"expired"}, removed)
+	}
+	for _, name := range []string{"known.ndjson", "recent.ndjson", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %v to be kept, got %v", name, err)
+		}
+	}
+
+	if _, err := RemoveResults(filepath.Join(dir, "missing"), time.Now(), func(string) bool { return false }); err != nil {
+		t.Errorf("Expected no error for a missing directory, got %v", err)
+	}
+}
+
+func TestRetentionFromEnv(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", DefaultRetention},
+		{"6h", 6 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"-1h", DefaultRetention},
+		{"a day", DefaultRetention},
+	}
+	for _, test := range tests {
+		t.Setenv("JOB_RETENTION", test.value)
+		if got := RetentionFromEnv(); got != test.expected {
+			t.Errorf("Expected %v for %q, got %v", test.expected, test.value, got)
+		}
+	}
+}
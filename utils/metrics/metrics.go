@@ -0,0 +1,119 @@
+// Package metrics measures how alike two portfolios are. Portfolios are
+// weights in %NAV keyed by holding (or by sector); every metric is
+// symmetric, so it does not matter which fund comes first.
+package metrics
+
+import (
+	"math"
+
+	"stockbackend/types"
+)
+
+// Weights is the %NAV a portfolio holds in each key
+type Weights map[string]float64
+
+// Portfolio is a fund's weights by holding and by sector
+type Portfolio struct {
+	Holdings Weights
+	Sectors  Weights
+}
+
+// Compare computes every metric for a and b
+func Compare(a, b Portfolio) types.Similarity {
+	return types.Similarity{
+		WeightOverlap: WeightOverlap(a.Holdings, b.Holdings),
+		Jaccard:       Jaccard(a.Holdings, b.Holdings),
+		Cosine:        Cosine(a.Holdings, b.Holdings),
+		ActiveShare:   ActiveShare(a.Holdings, b.Holdings),
+		SectorOverlap: SectorOverlap(a.Sectors, b.Sectors),
+	}
+}
+
+// WeightOverlap is the sum, over the holdings both portfolios hold, of the
+// smaller of the two weights: the part of the portfolios that is the same
+func WeightOverlap(a, b Weights) float64 {
+	overlap := 0.0
+	for key, weightA := range a {
+		if weightB, ok := b[key]; ok {
+			overlap += math.Min(weightA, weightB)
+		}
+	}
+	return overlap
+}
+
+// Jaccard is the number of holdings both portfolios hold over the number
+// either holds, from 0 to 1, whatever their weights
+func Jaccard(a, b Weights) float64 {
+	common := 0
+	for key := range a {
+		if _, ok := b[key]; ok {
+			common++
+		}
+	}
+	union := len(a) + len(b) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+// Cosine is the cosine similarity of the weight vectors, from 0 to 1.
+// Large positions count for more than they do in Jaccard.
+func Cosine(a, b Weights) float64 {
+	dot, normA, normB := 0.0, 0.0, 0.0
+	for key, weightA := range a {
+		dot += weightA * b[key]
+		normA += weightA * weightA
+	}
+	for _, weightB := range b {
+		normB += weightB * weightB
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// ActiveShare is half the sum of the weight differences, from 0 for the
+// same portfolio to 100 for portfolios with nothing in common. Each
+// portfolio is first scaled to 100%, so cash and the holdings left out do
+// not count as a difference.
+func ActiveShare(a, b Weights) float64 {
+	a, b = normalize(a), normalize(b)
+	if a == nil || b == nil {
+		return 100
+	}
+	difference := 0.0
+	for key, weightA := range a {
+		difference += math.Abs(weightA - b[key])
+	}
+	for key, weightB := range b {
+		if _, ok := a[key]; !ok {
+			difference += weightB
+		}
+	}
+	return difference / 2
+}
+
+// SectorOverlap is the weight overlap of the sector weights: the part of
+// the portfolios in the same sectors, even through different companies
+func SectorOverlap(a, b Weights) float64 {
+	return WeightOverlap(a, b)
+}
+
+// normalize scales weights to add up to 100. Without any weight there is
+// nothing to scale and nil is returned.
+func normalize(weights Weights) Weights {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return nil
+	}
+	scaled := make(Weights, len(weights))
+	for key, weight := range weights {
+		scaled[key] = weight / total * 100
+	}
+	return scaled
+}
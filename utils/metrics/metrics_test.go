@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"stockbackend/types"
+)
+
+var (
+	bluechip = Weights{"INE009A01021": 8.5, "INE040A01034": 9.5, "INE296A01024": 2}
+	largeCap = Weights{"INE009A01021": 6, "INE040A01034": 10, "INE154A01025": 4}
+	global   = Weights{"US02079K1079": 5}
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
+
+func TestWeightOverlap(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     Weights
+		expected float64
+	}{
+		{"common holdings", bluechip, largeCap, 15.5},
+		{"nothing in common", bluechip, global, 0},
+		{"same fund", bluechip, bluechip, 20},
+		{"empty", nil, bluechip, 0},
+	}
+	for _, test := range tests {
+		if got := WeightOverlap(test.a, test.b); !near(got, test.expected) {
+			t.Errorf("Expected %v for %s, got %v", test.expected, test.name, got)
+		}
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     Weights
+		expected float64
+	}{
+		{"common holdings", bluechip, largeCap, 0.5},
+		{"nothing in common", bluechip, global, 0},
+		{"same fund", bluechip, bluechip, 1},
+		{"both empty", nil, Weights{}, 0},
+	}
+	for _, test := range tests {
+		if got := Jaccard(test.a, test.b); !near(got, test.expected) {
+			t.Errorf("Expected %v for %s, got %v", test.expected, test.name, got)
+		}
+	}
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     Weights
+		expected float64
+	}{
+		// (8.5*6 + 9.5*10) / (sqrt(166.25) * sqrt(152))
+		{"common holdings", bluechip, largeCap, 0.9177},
+		{"nothing in common", bluechip, global, 0},
+		{"same fund", bluechip, bluechip, 1},
+		{"scaled fund", Weights{"a": 1, "b": 2}, Weights{"a": 3, "b": 6}, 1},
+		{"empty", nil, bluechip, 0},
+	}
+	for _, test := range tests {
+		if got := Cosine(test.a, test.b); !near(got, test.expected) {
+			t.Errorf("Expected %v for %s, got %v", test.expected, test.name, got)
+		}
+	}
+}
+
+func TestActiveShare(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     Weights
+		expected float64
+	}{
+		// Both add up to 20: |42.5-30| + |47.5-50| + 10 + 20, halved
+		{"common holdings", bluechip, largeCap, 22.5},
+		{"nothing in common", bluechip, global, 100},
+		{"same fund", bluechip, bluechip, 0},
+		{"scaled fund", Weights{"a": 1, "b": 2}, Weights{"a": 3, "b": 6}, 0},
+		{"empty", nil, bluechip, 100},
+	}
+	for _, test := range tests {
+		if got := ActiveShare(test.a, test.b); !near(got, test.expected) {
+			t.Errorf("Expected %v for %s, got %v", test.expected, test.name, got)
+		}
+	}
+}
+
+func TestSectorOverlap(t *testing.T) {
+	a := Weights{"banks": 18, "it - software": 8.5, "finance": 2}
+	b := Weights{"banks": 12, "it - software": 10, "diversified fmcg": 4}
+	if got := SectorOverlap(a, b); !near(got, 20.5) {
+		t.Errorf("Expected %v, got %v", 20.5, got)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a := Portfolio{Holdings: bluechip, Sectors: Weights{"banks": 9.5}}
+	b := Portfolio{Holdings: largeCap, Sectors: Weights{"banks": 10}}
+	got := Compare(a, b)
+	expected := types.Similarity{WeightOverlap: 15.5, Jaccard: 0.5, Cosine: 0.9177, ActiveShare: 22.5, SectorOverlap: 9.5}
+	if !near(got.WeightOverlap, expected.WeightOverlap) || !near(got.Jaccard, expected.Jaccard) ||
+		!near(got.Cosine, expected.Cosine) || !near(got.ActiveShare, expected.ActiveShare) ||
+		!near(got.SectorOverlap, expected.SectorOverlap) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+	if reversed := Compare(b, a); !near(reversed.Cosine, got.Cosine) || !near(reversed.ActiveShare, got.ActiveShare) {
+		t.Errorf("Expected %+v, got %+v", got, reversed)
+	}
+}
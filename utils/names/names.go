@@ -0,0 +1,95 @@
+// Package names matches company names as AMCs, exchanges and the company
+// database spell them.
+package names
+
+import (
+	"strings"
+	"unicode"
+)
+
+// abbreviations maps spelled-out words to the short forms used in company
+// names, so both spellings normalize to the same token
+var abbreviations = map[string]string{
+	"limited":         "ltd",
+	"corporation":     "corpn",
+	"corp":            "corpn",
+	"company":         "co",
+	"and":             "&",
+	"international":   "intl",
+	"industries":      "inds",
+	"technologies":    "tech",
+	"technology":      "tech",
+	"pharmaceuticals": "pharma",
+	"pharmaceutical":  "pharma",
+}
+
+// suffixes are legal-form tokens left out of keys and similarity, so
+// "Infosys Ltd" and "Infosys" are the same name
+var suffixes = map[string]bool{
+	"ltd": true, "corpn": true, "co": true, "inc": true, "the": true, "pvt": true, "private": true,
+}
+
+// Tokens splits a name into lower-case words without punctuation, with
+// common words abbreviated and runs of single letters ("K E C") joined
+func Tokens(name string) []string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '&':
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, name)
+
+	var tokens []string
+	initials := ""
+	for _, word := range strings.Fields(name) {
+		if short, ok := abbreviations[word]; ok {
+			word = short
+		}
+		if len([]rune(word)) == 1 && word != "&" {
+			initials += word
+			continue
+		}
+		if initials != "" {
+			tokens = append(tokens, initials)
+			initials = ""
+		}
+		tokens = append(tokens, word)
+	}
+	if initials != "" {
+		tokens = append(tokens, initials)
+	}
+	return tokens
+}
+
+// Key reduces a name to the form it is stored and looked up by: its
+// tokens without legal suffixes such as "Ltd"
+func Key(name string) string {
+	var words []string
+	for _, token := range Tokens(name) {
+		if !suffixes[token] {
+			words = append(words, token)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// searchRewrites are the spellings the company search expects
+var searchRewrites = map[string]string{
+	"limited":     "Ltd",
+	"corporation": "Corpn",
+	"and":         "&",
+}
+
+// SearchQuery rewrites a name into the abbreviations used by the company
+// database and search, e.g. "Larsen and Toubro Limited" becomes
+// "Larsen & Toubro Ltd"
+func SearchQuery(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		if short, ok := searchRewrites[strings.ToLower(word)]; ok {
+			words[i] = short
+		}
+	}
+	return strings.Join(words, " ")
+}
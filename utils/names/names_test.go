@@ -0,0 +1,39 @@
+package names
+
+import "testing"
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Infosys Limited", "infosys"},
+		{"INFOSYS LTD.", "infosys"},
+		{"Larsen and Toubro Limited", "larsen & toubro"},
+		{"Oil & Natural Gas Corporation Ltd", "oil & natural gas"},
+		{"K E C Intl.", "kec intl"},
+		{"KEC International Limited", "kec intl"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if result := Key(test.input); result != test.expected {
+			t.Errorf("Expected %q for %q, got %q", test.expected, test.input, result)
+		}
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Larsen and Toubro Limited", "Larsen & Toubro Ltd"},
+		{"Oil & Natural Gas Corporation Limited", "Oil & Natural Gas Corpn Ltd"},
+		{"HDFC Bank", "HDFC Bank"},
+	}
+	for _, test := range tests {
+		if result := SearchQuery(test.input); result != test.expected {
+			t.Errorf("Expected %q for %q, got %q", test.expected, test.input, result)
+		}
+	}
+}
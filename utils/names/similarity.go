@@ -0,0 +1,141 @@
+package names
+
+import (
+	"math"
+	"stockbackend/types"
+	"strings"
+)
+
+const (
+	// Confident is the similarity from which a name match is taken without
+	// asking for confirmation
+	Confident = 0.8
+	// Plausible is the similarity below which a search result is not
+	// taken to be the same company at all
+	Plausible = 0.5
+)
+
+// Similarity scores how alike two company names are, from 0 (nothing in
+// common) to 1 (the same key). It averages the trigram Dice coefficient,
+// which rewards shared words in any order, with Jaro-Winkler, which
+// rewards a shared start and tolerates typos.
+func Similarity(a, b string) float64 {
+	keyA, keyB := Key(a), Key(b)
+	if keyA == "" || keyB == "" {
+		return 0
+	}
+	if keyA == keyB {
+		return 1
+	}
+	score := (trigramSimilarity(keyA, keyB) + JaroWinkler(keyA, keyB)) / 2
+	return math.Round(score*1000) / 1000
+}
+
+// AliasConfidence is how sure a match through the alias is. Confirmed
+// aliases are certain. Learned ones score the confidence they were learned
+// with, or how alike the names are when that was not kept.
+func AliasConfidence(alias types.CompanyAlias) float64 {
+	switch {
+	case alias.Confirmed:
+		return 1
+	case alias.Confidence > 0:
+		return alias.Confidence
+	}
+	return Similarity(alias.Alias, alias.CompanyName)
+}
+
+// Best returns the index of the candidate most like name and its
+// similarity, or -1 when there are no candidates. Ties keep the earlier
+// candidate.
+func Best(name string, candidates []string) (int, float64) {
+	best, bestScore := -1, 0.0
+	for i, candidate := range candidates {
+		if score := Similarity(name, candidate); best < 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best, bestScore
+}
+
+func trigramSimilarity(a, b string) float64 {
+	trigramsA, trigramsB := trigrams(a), trigrams(b)
+	total := len(trigramsA) + len(trigramsB)
+	if total == 0 {
+		return 0
+	}
+	counts := make(map[string]int, len(trigramsA))
+	for _, trigram := range trigramsA {
+		counts[trigram]++
+	}
+	common := 0
+	for _, trigram := range trigramsB {
+		if counts[trigram] > 0 {
+			counts[trigram]--
+			common++
+		}
+	}
+	return float64(2*common) / float64(total)
+}
+
+// trigrams returns the character trigrams of each word, padded so short
+// words and word starts count
+func trigrams(key string) []string {
+	var all []string
+	for _, word := range strings.Fields(key) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			all = append(all, string(runes[i:i+3]))
+		}
+	}
+	return all
+}
+
+// JaroWinkler returns the Jaro-Winkler similarity of two strings
+func JaroWinkler(a, b string) float64 {
+	runesA, runesB := []rune(a), []rune(b)
+	if len(runesA) == 0 || len(runesB) == 0 {
+		return 0
+	}
+	window := max(len(runesA), len(runesB))/2 - 1
+	window = max(window, 0)
+
+	matchedA := make([]bool, len(runesA))
+	matchedB := make([]bool, len(runesB))
+	matches := 0
+	for i, r := range runesA {
+		for j := max(0, i-window); j < min(len(runesB), i+window+1); j++ {
+			if !matchedB[j] && runesB[j] == r {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i, r := range runesA {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if r != runesB[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(runesA)) + m/float64(len(runesB)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(runesA), len(runesB)) && runesA[prefix] == runesB[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,85 @@
+package names
+
+import (
+	"math"
+	"testing"
+
+	"stockbackend/types"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"Infosys Limited", "INFOSYS LTD.", 1},
+		{"HDFC Bank Limited", "HDFC Bank Ltd", 1},
+		{"Sun Pharmaceutical Industries Limited", "Sun Pharma.Inds.", 1},
+		{"", "Wipro Ltd", 0},
+	}
+	for _, test := range tests {
+		if result := Similarity(test.a, test.b); result != test.expected {
+			t.Errorf("Expected %v for %q and %q, got %v", test.expected, test.a, test.b, result)
+		}
+	}
+
+	if score := Similarity("Infosys Limited", "Wipro Ltd"); score >= Plausible {
+		t.Errorf("Expected unrelated names below %v, got %v", Plausible, score)
+	}
+	if score := Similarity("HDFC Bank", "HDFC Life"); score >= Confident {
+		t.Errorf("Expected sibling companies below %v, got %v", Confident, score)
+	}
+	close := Similarity("Larsen & Toubro Limited", "Larsen and Toubro Ltd")
+	far := Similarity("Larsen & Toubro Limited", "L&T Finance Ltd")
+	if close <= far {
+		t.Errorf("Expected %v to be above %v", close, far)
+	}
+}
+
+func TestAliasConfidence(t *testing.T) {
+	tests := []struct {
+		name     string
+		alias    types.CompanyAlias
+		expected float64
+	}{
+		{"confirmed", types.CompanyAlias{Alias: "Sandhar Technologies Limited", CompanyName: "Sandhar Tech", Confirmed: true}, 1},
+		{"learned", types.CompanyAlias{Alias: "HDFC Bank Limited", CompanyName: "HDFC Bank", Confidence: 0.85}, 0.85},
+		{"learned before confidence was kept", types.CompanyAlias{Alias: "HDFC Bank Limited", CompanyName: "HDFC Life"}, Similarity("HDFC Bank Limited", "HDFC Life")},
+	}
+	for _, test := range tests {
+		if got := AliasConfidence(test.alias); got != test.expected {
+			t.Errorf("Expected %v for %s, got %v", test.expected, test.name, got)
+		}
+	}
+	if got := AliasConfidence(types.CompanyAlias{Alias: "HDFC Bank Limited", CompanyName: "HDFC Life"}); got >= Confident {
+		t.Errorf("Expected a learned alias to a sibling company below %v, got %v", Confident, got)
+	}
+}
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"martha", "marhta", 0.961},
+		{"dixon", "dicksonx", 0.813},
+		{"abc", "abc", 1},
+		{"abc", "xyz", 0},
+	}
+	for _, test := range tests {
+		result := math.Round(JaroWinkler(test.a, test.b)*1000) / 1000
+		if result != test.expected {
+			t.Errorf("Expected %v for %q and %q, got %v", test.expected, test.a, test.b, result)
+		}
+	}
+}
+
+func TestBest(t *testing.T) {
+	index, score := Best("Tata Motors Limited", []string{"Tata Steel Ltd", "Tata Motors Ltd", "Tata Power Co Ltd"})
+	if index != 1 || score != 1 {
+		t.Errorf("Expected Tata Motors Ltd with 1, got %v with %v", index, score)
+	}
+	if index, _ := Best("Tata Motors Limited", nil); index != -1 {
+		t.Errorf("Expected -1 without candidates, got %v", index)
+	}
+}
@@ -0,0 +1,178 @@
+// Package overlap compares the holdings of several mutual funds: how much
+// of each fund every other fund also holds, what all of them hold, and
+// what only one of them holds.
+package overlap
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"stockbackend/types"
+	"stockbackend/utils/holdings"
+	"stockbackend/utils/metrics"
+	"stockbackend/utils/names"
+)
+
+// ErrTooFewFunds is returned by Compare when there is nothing to compare
+var ErrTooFewFunds = errors.New("at least two funds are needed for a comparison")
+
+// Key identifies an instrument across funds by its ISIN, or by its name
+// when it has none
+func Key(instrument types.Instrument) string {
+	if isin := strings.ToUpper(strings.TrimSpace(instrument.Isin)); isin != "" {
+		return isin
+	}
+	return "name:" + names.Key(instrument.Name)
+}
+
+// fund is a fund's holdings keyed by Key. An instrument listed on several
+// lines counts once, with the weights of its lines added up.
+type fund struct {
+	name        string
+	extraction  string
+	keys        []string
+	instruments map[string]types.Instrument
+	weights     metrics.Weights
+	sectors     metrics.Weights
+	totalWeight float64
+}
+
+func newFund(mf types.MFInstrument) *fund {
+	f := &fund{
+		name:        mf.Name,
+		extraction:  mf.Extraction,
+		instruments: make(map[string]types.Instrument),
+		weights:     make(metrics.Weights),
+		sectors:     make(metrics.Weights),
+	}
+	for _, instrument := range mf.Instruments {
+		key := Key(instrument)
+		// A line with neither an ISIN nor a name matches nothing
+		if key == "name:" {
+			continue
+		}
+		if _, seen := f.instruments[key]; !seen {
+			f.keys = append(f.keys, key)
+			f.instruments[key] = instrument
+		}
+		weight := holdings.ParseNumber(instrument.Percentage)
+		f.weights[key] += weight
+		f.totalWeight += weight
+		if sector := SectorKey(instrument.Industry); sector != "" {
+			f.sectors[sector] += weight
+		}
+	}
+	return f
+}
+
+func (f *fund) portfolio() metrics.Portfolio {
+	return metrics.Portfolio{Holdings: f.weights, Sectors: f.sectors}
+}
+
+// SectorKey is the industry of a holding in the form sectors are compared
+// in: AMCs write the same industry in different case and spacing
+func SectorKey(industry string) string {
+	return strings.ToLower(strings.Join(strings.Fields(industry), " "))
+}
+
+// Compare works out the overlap of every pair of funds, the holdings
+// common to all of them and the holdings unique to each
+func Compare(funds []types.MFInstrument) (types.FundComparison, error) {
+	if len(funds) < 2 {
+		return types.FundComparison{}, ErrTooFewFunds
+	}
+	parsed := make([]*fund, len(funds))
+	for i, mf := range funds {
+		parsed[i] = newFund(mf)
+	}
+
+	comparison := types.FundComparison{
+		Funds:          make([]types.ComparedFund, len(parsed)),
+		Matrix:         make([][]types.FundOverlap, len(parsed)),
+		CommonToAll:    []types.CommonHolding{},
+		UniqueHoldings: make([]types.UniqueHoldings, len(parsed)),
+	}
+	for i, f := range parsed {
+		comparison.Funds[i] = types.ComparedFund{Name: f.name, Holdings: len(f.keys), TotalWeight: round(f.totalWeight), Extraction: f.extraction}
+		comparison.Matrix[i] = make([]types.FundOverlap, len(parsed))
+		for j, other := range parsed {
+			comparison.Matrix[i][j] = pairOverlap(f, other)
+			comparison.Matrix[i][j].Similarity = similarity(f, other)
+		}
+	}
+
+	// Common holdings are listed in the order of the first fund
+	for _, key := range parsed[0].keys {
+		if holders(parsed, key) < len(parsed) {
+			continue
+		}
+		weights := make([]float64, len(parsed))
+		for i, f := range parsed {
+			weights[i] = round(f.weights[key])
+		}
+		instrument := parsed[0].instruments[key]
+		comparison.CommonToAll = append(comparison.CommonToAll, types.CommonHolding{
+			Name:    instrument.Name,
+			Isin:    instrument.Isin,
+			Symbol:  instrument.Symbol,
+			Weights: weights,
+		})
+	}
+
+	for i, f := range parsed {
+		unique := []types.Instrument{}
+		for _, key := range f.keys {
+			if holders(parsed, key) == 1 {
+				unique = append(unique, f.instruments[key])
+			}
+		}
+		comparison.UniqueHoldings[i] = types.UniqueHoldings{Fund: f.name, Holdings: unique}
+	}
+	return comparison, nil
+}
+
+// pairOverlap is how much of f other also holds
+func pairOverlap(f, other *fund) types.FundOverlap {
+	var overlap types.FundOverlap
+	weight := 0.0
+	for _, key := range f.keys {
+		if _, ok := other.instruments[key]; ok {
+			overlap.Common++
+			weight += f.weights[key]
+		}
+	}
+	if len(f.keys) > 0 {
+		overlap.CountPercentage = round(float64(overlap.Common) / float64(len(f.keys)) * 100)
+	}
+	overlap.WeightPercentage = round(weight)
+	return overlap
+}
+
+// similarity is every metric of the pair, rounded as they are shown:
+// weights to two decimals and ratios to four
+func similarity(f, other *fund) types.Similarity {
+	similarity := metrics.Compare(f.portfolio(), other.portfolio())
+	similarity.WeightOverlap = round(similarity.WeightOverlap)
+	similarity.Jaccard = math.Round(similarity.Jaccard*10000) / 10000
+	similarity.Cosine = math.Round(similarity.Cosine*10000) / 10000
+	similarity.ActiveShare = round(similarity.ActiveShare)
+	similarity.SectorOverlap = round(similarity.SectorOverlap)
+	return similarity
+}
+
+// holders counts the funds that hold key
+func holders(funds []*fund, key string) int {
+	count := 0
+	for _, f := range funds {
+		if _, ok := f.instruments[key]; ok {
+			count++
+		}
+	}
+	return count
+}
+
+// round keeps two decimals, as the percentages are shown
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,153 @@
+package overlap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"stockbackend/types"
+)
+
+func instrument(name, isin, percentage string) types.Instrument {
+	return types.Instrument{Name: name, Isin: isin, Percentage: percentage}
+}
+
+var funds = []types.MFInstrument{
+	{Name: "Axis Bluechip Fund", Extraction: "header", Instruments: []types.Instrument{
+		instrument("Infosys Ltd", "INE009A01021", "8.5%"),
+		instrument("HDFC Bank Ltd", "INE040A01034", "9.5"),
+		instrument("Bajaj Finance Ltd", "INE296A01024", "2"),
+		instrument("Avenue Supermarts Ltd", "", "5"),
+	}},
+	{Name: "Mirae Asset Large Cap Fund", Extraction: "llm", Instruments: []types.Instrument{
+		instrument("Infosys Limited", "ine009a01021", "6"),
+		instrument("HDFC Bank Ltd", "INE040A01034", "10"),
+		instrument("Avenue Supermarts Limited", "", "1"),
+		instrument("ITC Ltd", "INE154A01025", "3"),
+	}},
+	{Name: "Parag Parikh Flexi Cap Fund", Instruments: []types.Instrument{
+		instrument("HDFC Bank Ltd", "INE040A01034", "7.5"),
+		instrument("HDFC Bank Ltd", "INE040A01034", "0.5"),
+		instrument("ITC Ltd", "INE154A01025", "5"),
+		instrument("Alphabet Inc", "US02079K1079", "4"),
+	}},
+}
+
+func TestCompare_Matrix(t *testing.T) {
+	comparison, err := Compare(funds)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(comparison.Matrix) != 3 || len(comparison.Matrix[0]) != 3 {
+		t.Fatalf("Expected a 3x3 matrix, got %v", comparison.Matrix)
+	}
+	tests := []struct {
+		i, j     int
+		expected types.FundOverlap
+	}{
+		// Infosys by ISIN in any case, D-Mart by name, HDFC Bank
+		{0, 1, types.FundOverlap{Common: 3, CountPercentage: 75, WeightPercentage: 23}},
+		{1, 0, types.FundOverlap{Common: 3, CountPercentage: 75, WeightPercentage: 17}},
+		{0, 2, types.FundOverlap{Common: 1, CountPercentage: 25, WeightPercentage: 9.5}},
+		// HDFC Bank is listed twice and counts once, with both weights
+		{2, 0, types.FundOverlap{Common: 1, CountPercentage: 33.33, WeightPercentage: 8}},
+		{1, 2, types.FundOverlap{Common: 2, CountPercentage: 50, WeightPercentage: 13}},
+		{2, 2, types.FundOverlap{Common: 3, CountPercentage: 100, WeightPercentage: 17}},
+	}
+	for _, test := range tests {
+		got := comparison.Matrix[test.i][test.j]
+		got.Similarity = types.Similarity{}
+		if got != test.expected {
+			t.Errorf("Expected %+v for %d/%d, got %+v", test.expected, test.i, test.j, got)
+		}
+	}
+	if fund := comparison.Funds[2]; fund.Holdings != 3 || fund.TotalWeight != 17 {
+		t.Errorf("Expected 3 holdings weighing 17, got %+v", fund)
+	}
+	if comparison.Funds[0].Extraction != "header" || comparison.Funds[1].Extraction != "llm" {
+		t.Errorf("Expected the extraction of each fund, got %+v", comparison.Funds)
+	}
+}
+
+func TestCompare_Similarity(t *testing.T) {
+	comparison, _ := Compare(funds)
+	expected := types.Similarity{WeightOverlap: 16.5, Jaccard: 0.6, Cosine: 0.9031, ActiveShare: 27}
+	for _, got := range []types.Similarity{comparison.Matrix[0][1].Similarity, comparison.Matrix[1][0].Similarity} {
+		if got != expected {
+			t.Errorf("Expected %+v, got %+v", expected, got)
+		}
+	}
+	if got := comparison.Matrix[2][2].Similarity; got.Jaccard != 1 || got.Cosine != 1 || got.ActiveShare != 0 {
+		t.Errorf("Expected a fund to be identical to itself, got %+v", got)
+	}
+
+	// Different banks still overlap by sector, whatever the spelling
+	banks := []types.MFInstrument{
+		{Name: "Axis Bluechip Fund", Instruments: []types.Instrument{
+			{Name: "HDFC Bank Ltd", Isin: "INE040A01034", Industry: "Banks", Percentage: "9"},
+			{Name: "Infosys Ltd", Isin: "INE009A01021", Industry: "IT - Software", Percentage: "6"},
+		}},
+		{Name: "Mirae Asset Large Cap Fund", Instruments: []types.Instrument{
+			{Name: "ICICI Bank Ltd", Isin: "INE090A01021", Industry: " banks ", Percentage: "7"},
+			{Name: "ITC Ltd", Isin: "INE154A01025", Industry: "Diversified FMCG", Percentage: "4"},
+		}},
+	}
+	comparison, _ = Compare(banks)
+	if got := comparison.Matrix[0][1].Similarity; got.WeightOverlap != 0 || got.SectorOverlap != 7 {
+		t.Errorf("Expected no holding overlap and a sector overlap of 7, got %+v", got)
+	}
+}
+
+func TestCompare_CommonAndUnique(t *testing.T) {
+	comparison, _ := Compare(funds)
+	expected := []types.CommonHolding{{Name: "HDFC Bank Ltd", Isin: "INE040A01034", Weights: []float64{9.5, 10, 8}}}
+	if !reflect.DeepEqual(comparison.CommonToAll, expected) {
+		t.Errorf("Expected %v, got %v", expected, comparison.CommonToAll)
+	}
+
+	unique := make(map[string][]string)
+	for _, fund := range comparison.UniqueHoldings {
+		for _, holding := range fund.Holdings {
+			unique[fund.Fund] = append(unique[fund.Fund], holding.Name)
+		}
+	}
+	expectedUnique := map[string][]string{
+		"Axis Bluechip Fund":          {"Bajaj Finance Ltd"},
+		"Parag Parikh Flexi Cap Fund": {"Alphabet Inc"},
+	}
+	if !reflect.DeepEqual(unique, expectedUnique) {
+		t.Errorf("Expected %v, got %v", expectedUnique, unique)
+	}
+}
+
+// Weights are read the way holdings are extracted: a short position
+// printed in brackets is negative
+func TestCompare_Weights(t *testing.T) {
+	comparison, err := Compare([]types.MFInstrument{
+		{Name: "Axis Arbitrage Fund", Instruments: []types.Instrument{
+			instrument("Infosys Ltd", "INE009A01021", "6.55 %"),
+			instrument("Infosys Ltd Futures", "INE009A01021", "(0.50)"),
+		}},
+		{Name: "Axis Bluechip Fund", Instruments: []types.Instrument{
+			instrument("Infosys Ltd", "INE009A01021", "10.50%"),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if weight := comparison.Funds[0].TotalWeight; weight != 6.05 {
+		t.Errorf("Expected %v, got %v", 6.05, weight)
+	}
+	expected := []float64{6.05, 10.5}
+	if len(comparison.CommonToAll) != 1 || !reflect.DeepEqual(comparison.CommonToAll[0].Weights, expected) {
+		t.Errorf("Expected weights %v, got %v", expected, comparison.CommonToAll)
+	}
+}
+
+func TestCompare_TooFewFunds(t *testing.T) {
+	for _, given := range [][]types.MFInstrument{nil, funds[:1]} {
+		if _, err := Compare(given); !errors.Is(err, ErrTooFewFunds) {
+			t.Errorf("Expected %v for %d funds, got %v", ErrTooFewFunds, len(given), err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package pool runs the steps of a request on a bounded pool of
+// goroutines. A step that panics is recovered and handed to a callback, so
+// one bad row cannot take down the server the way an unrecovered panic off
+// the request goroutine would.
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Recovered is called on the worker's goroutine with the index of a step
+// that panicked and the value it panicked with
+type Recovered func(index int, value interface{})
+
+// run calls work for index, passing a panic to recovered
+func run(index int, work func(index int), recovered Recovered) {
+	defer func() {
+		if value := recover(); value != nil {
+			recovered(index, value)
+		}
+	}()
+	work(index)
+}
+
+// Ordered runs work for every index below n on workers goroutines and
+// passes each index to onDone in order, once every earlier index has been
+// passed. A step that panics still counts as done. An error from onDone,
+// or ctx being cancelled, stops the remaining work and is returned.
+func Ordered(ctx context.Context, n, workers int, work func(ctx context.Context, index int), recovered Recovered, onDone func(index int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	workers = max(workers, 1)
+
+	indexes := make(chan int)
+	results := make(chan int, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				run(index, func(index int) { work(ctx, index) }, recovered)
+				results <- index
+			}
+		}()
+	}
+	go func() {
+		defer close(indexes)
+		for index := 0; index < n; index++ {
+			select {
+			case indexes <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results arrive in completion order; hold each one back until every
+	// earlier index has been handed over
+	pending := make(map[int]bool)
+	next := 0
+	var err error
+	for index := range results {
+		if err != nil {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			continue
+		}
+		pending[index] = true
+		for pending[next] {
+			delete(pending, next)
+			if err = onDone(next); err != nil {
+				cancel()
+				break
+			}
+			next++
+		}
+	}
+	// Cancelled before every index was handed to a worker
+	if err == nil && next < n {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// Each runs work for every index below n, at most workers at a time, and
+// waits for all of them
+func Each(n, workers int, work func(index int), recovered Recovered) {
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for index := 0; index < n; index++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(index int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			run(index, work, recovered)
+		}(index)
+	}
+	wg.Wait()
+}
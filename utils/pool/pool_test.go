@@ -0,0 +1,116 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrdered(t *testing.T) {
+	var order []int
+	err := Ordered(context.Background(), 20, 4,
+		func(ctx context.Context, index int) {
+			// Later rows finish first
+			time.Sleep(time.Duration(20-index) * time.Millisecond)
+		},
+		func(index int, value interface{}) {
+			t.Errorf("Expected no panic, got %v", value)
+		},
+		func(index int) error {
+			order = append(order, index)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i, index := range order {
+		if index != i {
+			t.Fatalf("Expected rows in order, got %v", order)
+		}
+	}
+	if len(order) != 20 {
+		t.Errorf("Expected 20 rows, got %v", len(order))
+	}
+}
+
+func TestOrdered_Panic(t *testing.T) {
+	holdings := []map[string]interface{}{
+		{"name": "Infosys Ltd"},
+		{"name": "HDFC Bank Ltd"},
+		{"name": "Bajaj Finance Ltd"},
+	}
+	var order []string
+	err := Ordered(context.Background(), len(holdings), 2,
+		func(ctx context.Context, index int) {
+			if index == 1 {
+				var result map[string]interface{}
+				result["score"] = 7 // a nil map, as a broken company document would give
+			}
+			holdings[index]["status"] = "resolved"
+		},
+		func(index int, value interface{}) {
+			holdings[index]["status"] = "unresolved"
+		},
+		func(index int) error {
+			order = append(order, holdings[index]["name"].(string)+" "+holdings[index]["status"].(string))
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{"Infosys Ltd resolved", "HDFC Bank Ltd unresolved", "Bajaj Finance Ltd resolved"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected %v, got %v", expected, order)
+	}
+}
+
+func TestOrdered_Stops(t *testing.T) {
+	stop := errors.New("client gone")
+	var handed int
+	err := Ordered(context.Background(), 100, 4,
+		func(ctx context.Context, index int) {},
+		func(index int, value interface{}) {},
+		func(index int) error {
+			handed++
+			if index == 9 {
+				return stop
+			}
+			return nil
+		})
+	if !errors.Is(err, stop) || handed != 10 {
+		t.Errorf("Expected %v after 10 rows, got %v after %v", stop, err, handed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Ordered(ctx, 100, 4, func(ctx context.Context, index int) {}, func(index int, value interface{}) {}, func(index int) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestEach_Panic(t *testing.T) {
+	var mu sync.Mutex
+	done := make(map[int]bool)
+	var recovered []interface{}
+	Each(10, 3,
+		func(index int) {
+			if index%4 == 0 {
+				panic("lookup failed")
+			}
+			mu.Lock()
+			done[index] = true
+			mu.Unlock()
+		},
+		func(index int, value interface{}) {
+			mu.Lock()
+			recovered = append(recovered, value)
+			mu.Unlock()
+		})
+	if len(done) != 7 || len(recovered) != 3 {
+		t.Errorf("Expected 7 steps done and 3 recovered, got %v and %v", len(done), len(recovered))
+	}
+}
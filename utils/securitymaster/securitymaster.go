@@ -0,0 +1,174 @@
+// Package securitymaster reads the equity master files published by the
+// exchanges into types.Security records.
+package securitymaster
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"stockbackend/types"
+	"stockbackend/utils/names"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownFormat is returned for CSVs without an ISIN and a company name column
+var ErrUnknownFormat = errors.New("not an equity master file")
+
+var isinPattern = regexp.MustCompile(`^IN[A-Z0-9]{10}$`)
+
+// columns lists the headers each field goes by, best first. NSE's
+// EQUITY_L.csv and BSE's scrip list are both covered.
+var columns = map[string][]string{
+	"isin":      {"isin number", "isin no", "isin code", "isin"},
+	"symbol":    {"symbol", "nse symbol"},
+	"bseCode":   {"security code", "scrip code", "bse code"},
+	"name":      {"name of company", "issuer name", "company name", "security name", "name"},
+	"faceValue": {"face value", "facevalue", "face val"},
+	"type":      {"instrument"},
+}
+
+// Parse reads an NSE or BSE equity master CSV. Rows without a valid ISIN,
+// and non-equity rows of BSE's list, are skipped.
+func Parse(r io.Reader) ([]types.Security, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	index := headerIndex(header)
+	if _, ok := index["isin"]; !ok {
+		return nil, ErrUnknownFormat
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, ErrUnknownFormat
+	}
+
+	var securities []types.Security
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading row: %w", err)
+		}
+		field := func(name string) string {
+			i, ok := index[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		isin := strings.ToUpper(field("isin"))
+		if !isinPattern.MatchString(isin) {
+			continue
+		}
+		if kind := field("type"); kind != "" && !strings.EqualFold(kind, "equity") {
+			continue
+		}
+		faceValue, _ := strconv.ParseFloat(strings.ReplaceAll(field("faceValue"), ",", ""), 64)
+		securities = append(securities, types.Security{
+			ISIN:      isin,
+			NSESymbol: strings.ToUpper(field("symbol")),
+			BSECode:   field("bseCode"),
+			Name:      field("name"),
+			NameKey:   names.Key(field("name")),
+			FaceValue: faceValue,
+		})
+	}
+	return securities, nil
+}
+
+func headerIndex(header []string) map[string]int {
+	normalized := make([]string, len(header))
+	for i, cell := range header {
+		normalized[i] = strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(cell, "\uFEFF")), " "))
+	}
+
+	index := make(map[string]int)
+	for field, names := range columns {
+	search:
+		for _, name := range names {
+			for i, cell := range normalized {
+				if cell == name {
+					index[field] = i
+					break search
+				}
+			}
+		}
+	}
+	return index
+}
+
+var companyPath = regexp.MustCompile(`/company/([^/?#]+)`)
+
+// CompanyCode returns the exchange code in a company page URL such as
+// /company/INFY/consolidated/, which is the NSE symbol or else the BSE code
+func CompanyCode(url string) string {
+	match := companyPath.FindStringSubmatch(url)
+	if match == nil {
+		return ""
+	}
+	return strings.ToUpper(match[1])
+}
+
+// Codes returns the exchange codes a company page of the security can be
+// listed under
+func Codes(security types.Security) []string {
+	var codes []string
+	if security.NSESymbol != "" {
+		codes = append(codes, strings.ToUpper(security.NSESymbol))
+	}
+	if security.BSECode != "" {
+		codes = append(codes, security.BSECode)
+	}
+	return codes
+}
+
+// Holding is the name and ISIN a disclosure lists a holding under
+type Holding struct {
+	Name string
+	ISIN string
+}
+
+// Keys returns the distinct ISINs and names to look the holdings up by,
+// leaving out those already known. ISINs are collected before names are
+// deduplicated: two lines can share a name and still list different ISINs,
+// and each ISIN must be looked up.
+func Keys(holdings []Holding, knownISIN, knownName func(key string) bool) (isins, holdingNames []string) {
+	seenISIN := make(map[string]bool)
+	seenName := make(map[string]bool)
+	for _, holding := range holdings {
+		if isin := holding.ISIN; isin != "" && !seenISIN[isin] && !knownISIN(isin) {
+			seenISIN[isin] = true
+			isins = append(isins, isin)
+		}
+		key := names.Key(holding.Name)
+		if holding.Name == "" || seenName[key] || knownName(key) {
+			continue
+		}
+		seenName[key] = true
+		holdingNames = append(holdingNames, holding.Name)
+	}
+	return isins, holdingNames
+}
+
+// SearchName is the name a holding is text searched by when no company
+// was found by its ISIN: the exchange's company name when the master knows
+// the ISIN, or else the disclosure's own name. Holdings with an ISIN are
+// still searched, since company documents only carry the ISINs learned
+// from earlier confident matches; a confident hit stores the ISIN on the
+// company, so the next upload resolves it by ISIN.
+func SearchName(holding Holding, securities map[string]types.Security) string {
+	if security, ok := securities[holding.ISIN]; ok && holding.ISIN != "" && security.Name != "" {
+		return security.Name
+	}
+	return holding.Name
+}
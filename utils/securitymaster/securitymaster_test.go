@@ -0,0 +1,120 @@
+package securitymaster
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"stockbackend/types"
+)
+
+func TestParse_NSE(t *testing.T) {
+	csv := `SYMBOL,NAME OF COMPANY, SERIES, DATE OF LISTING, PAID UP VALUE, MARKET LOT, ISIN NUMBER, FACE VALUE
+INFY,Infosys Limited,EQ,08-FEB-1995,5,1,INE009A01021,5
+BAD,Bad Row,EQ,01-JAN-2000,10,1,NOT-AN-ISIN,10
+`
+	securities, err := Parse(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(securities) != 1 {
+		t.Fatalf("Expected 1 security, got %v", securities)
+	}
+	security := securities[0]
+	if security.ISIN != "INE009A01021" || security.NSESymbol != "INFY" || security.Name != "Infosys Limited" || security.FaceValue != 5 {
+		t.Errorf("Expected Infosys from NSE, got %+v", security)
+	}
+	if security.BSECode != "" {
+		t.Errorf("Expected no BSE code, got %v", security.BSECode)
+	}
+}
+
+func TestParse_BSE(t *testing.T) {
+	csv := "\uFEFFSecurity Code,Issuer Name,Security Id,Security Name,Status,Group,Face Value,ISIN No,Industry,Instrument\n" +
+		"500209,Infosys Ltd,INFY,INFOSYS LTD.,Active,A,5.00,ine009a01021,IT,Equity\n" +
+		"959999,Some Issuer,SOMEDEBT,Some NCD,Active,F,\"1,000.00\",INE999A07011,,Debentures\n"
+	securities, err := Parse(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(securities) != 1 {
+		t.Fatalf("Expected only the equity row, got %v", securities)
+	}
+	security := securities[0]
+	if security.ISIN != "INE009A01021" || security.BSECode != "500209" || security.Name != "Infosys Ltd" || security.NSESymbol != "" {
+		t.Errorf("Expected Infosys from BSE, got %+v", security)
+	}
+}
+
+func TestParse_UnknownFormat(t *testing.T) {
+	_, err := Parse(strings.NewReader("Date,Open,Close\n2024-01-01,1,2\n"))
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestCompanyCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://www.screener.in/company/INFY/consolidated/", "INFY"},
+		{"/company/500209/", "500209"},
+		{"/company/m&m", "M&M"},
+		{"https://www.screener.in/", ""},
+	}
+	for _, test := range tests {
+		if result := CompanyCode(test.input); result != test.expected {
+			t.Errorf("Expected %q for %q, got %q", test.expected, test.input, result)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	holdings := []Holding{
+		{Name: "Infosys Ltd", ISIN: "INE009A01021"},
+		// Same name as the line above, another ISIN (a partly paid share)
+		{Name: "Infosys Limited", ISIN: "IN9009A01021"},
+		{Name: "HDFC Bank Ltd", ISIN: "INE040A01034"},
+		// Name already resolved in an earlier sheet, new ISIN
+		{Name: "ITC Ltd", ISIN: "INE154A01025"},
+		{Name: "Reliance Industries Ltd", ISIN: "INE002A01018"},
+		{Name: "Treps"},
+		{ISIN: "INE467B01029"},
+	}
+	isins, holdingNames := Keys(holdings,
+		func(isin string) bool { return isin == "INE002A01018" },
+		func(key string) bool { return key == "itc" })
+
+	expectedISINs := []string{"INE009A01021", "IN9009A01021", "INE040A01034", "INE154A01025", "INE467B01029"}
+	if !reflect.DeepEqual(isins, expectedISINs) {
+		t.Errorf("Expected %v, got %v", expectedISINs, isins)
+	}
+	expectedNames := []string{"Infosys Ltd", "HDFC Bank Ltd", "Reliance Industries Ltd", "Treps"}
+	if !reflect.DeepEqual(holdingNames, expectedNames) {
+		t.Errorf("Expected %v, got %v", expectedNames, holdingNames)
+	}
+}
+
+func TestSearchName(t *testing.T) {
+	securities := map[string]types.Security{
+		"INE009A01021": {ISIN: "INE009A01021", Name: "Infosys Limited"},
+	}
+	tests := []struct {
+		holding  Holding
+		expected string
+	}{
+		// The master knows the ISIN: search by the exchange's name
+		{Holding{Name: "Infosys Ltd - Equity", ISIN: "INE009A01021"}, "Infosys Limited"},
+		// An ISIN no company carries yet and the master does not know is
+		// still searched by name, so a confident hit can learn it
+		{Holding{Name: "Avenue Supermarts Ltd", ISIN: "INE192R01011"}, "Avenue Supermarts Ltd"},
+		{Holding{Name: "Avenue Supermarts Ltd"}, "Avenue Supermarts Ltd"},
+	}
+	for _, test := range tests {
+		if got := SearchName(test.holding, securities); got != test.expected {
+			t.Errorf("Expected %q for %v, got %q", test.expected, test.holding, got)
+		}
+	}
+}
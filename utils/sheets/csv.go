@@ -0,0 +1,111 @@
+package sheets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"stockbackend/utils/upload"
+)
+
+// delimiters are the separators a CSV file may use
+var delimiters = []rune{',', ';', '\t', '|'}
+
+type csvWorkbook struct {
+	file  *os.File
+	sheet string
+}
+
+// OpenCSV reads a CSV file as a workbook with one sheet. The delimiter is
+// read from the start of the file: a comma, semicolon, tab or pipe.
+func OpenCSV(file *os.File, sheet string) (Workbook, error) {
+	return &csvWorkbook{file: file, sheet: sheet}, nil
+}
+
+func (w *csvWorkbook) Format() string {
+	return upload.KindCSV
+}
+
+func (w *csvWorkbook) Sheets() []string {
+	return []string{w.sheet}
+}
+
+func (w *csvWorkbook) Rows(sheet string, fn func(row []string) bool) error {
+	if sheet != w.sheet {
+		return errors.New("sheet " + sheet + " does not exist")
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(w.file)
+	if bom, err := reader.Peek(3); err == nil && bytes.Equal(bom, []byte("\xEF\xBB\xBF")) {
+		reader.Discard(3)
+	}
+	// Peek returns what it has along with an error for short files
+	head, _ := reader.Peek(4096)
+
+	records := csv.NewReader(reader)
+	records.Comma = detectDelimiter(head)
+	records.FieldsPerRecord = -1
+	records.LazyQuotes = true
+	for {
+		row, err := records.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(trimRow(row)) {
+			return nil
+		}
+	}
+}
+
+func (w *csvWorkbook) Close() error {
+	return w.file.Close()
+}
+
+// detectDelimiter picks the separator that occurs most often outside
+// quotes. The whole head is counted rather than the first line, as
+// disclosures often open with a title line.
+func detectDelimiter(head []byte) rune {
+	counts := make(map[rune]int)
+	quoted := false
+	for _, r := range string(head) {
+		if r == '"' {
+			quoted = !quoted
+			continue
+		}
+		if !quoted {
+			counts[r]++
+		}
+	}
+	best := delimiters[0]
+	for _, delimiter := range delimiters[1:] {
+		if counts[delimiter] > counts[best] {
+			best = delimiter
+		}
+	}
+	return best
+}
+
+// trimRow drops the empty cells at the end of a row
+func trimRow(row []string) []string {
+	end := len(row)
+	for end > 0 && row[end-1] == "" {
+		end--
+	}
+	return row[:end]
+}
+
+// sheetName names the only sheet of a CSV file after the file
+func sheetName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
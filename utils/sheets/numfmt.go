@@ -0,0 +1,544 @@
+package sheets
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/nfp"
+)
+
+// builtInFormats are the number formats Excel does not save in workbooks,
+// with the codes excelize gives them, so a built-in format reads the same
+// from an XLS as from an XLSX
+var builtInFormats = map[uint16]string{
+	0:  "General",
+	1:  "0",
+	2:  "0.00",
+	3:  "#,##0",
+	4:  "#,##0.00",
+	9:  "0%",
+	10: "0.00%",
+	11: "0.00E+00",
+	12: "# ?/?",
+	13: "# ??/??",
+	14: "mm-dd-yy",
+	15: "d-mmm-yy",
+	16: "d-mmm",
+	17: "mmm-yy",
+	18: "h:mm AM/PM",
+	19: "h:mm:ss AM/PM",
+	20: "hh:mm",
+	21: "hh:mm:ss",
+	22: "m/d/yy hh:mm",
+	37: "#,##0 ;(#,##0)",
+	38: "#,##0 ;[red](#,##0)",
+	39: "#,##0.00 ;(#,##0.00)",
+	40: "#,##0.00 ;[red](#,##0.00)",
+	41: `_(* #,##0_);_(* \(#,##0\);_(* "-"_);_(@_)`,
+	42: `_("$"* #,##0_);_("$"* \(#,##0\);_("$"* "-"_);_(@_)`,
+	43: `_(* #,##0.00_);_(* \(#,##0.00\);_(* "-"??_);_(@_)`,
+	44: `_("$"* #,##0.00_);_("$"* \(#,##0.00\);_("$"* "-"??_);_(@_)`,
+	45: "mm:ss",
+	46: "[h]:mm:ss",
+	47: "mm:ss.0",
+	48: "##0.0E+0",
+	49: "@",
+}
+
+var (
+	excel1900Epoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	excel1904Epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// numberTokens and dateTokens are the tokens that make a section format a
+// number or a date. Tokens in neither set, such as literals and colours,
+// only decorate the value.
+var (
+	numberTokens = map[string]bool{
+		nfp.TokenTypeDigitalPlaceHolder: true,
+		nfp.TokenTypeExponential:        true,
+		nfp.TokenTypeHashPlaceHolder:    true,
+		nfp.TokenTypePercent:            true,
+		nfp.TokenTypeZeroPlaceHolder:    true,
+	}
+	dateTokens = map[string]bool{
+		nfp.TokenTypeDateTimes:        true,
+		nfp.TokenTypeElapsedDateTimes: true,
+	}
+	decorationTokens = map[string]bool{
+		nfp.TokenTypeColor:              true,
+		nfp.TokenTypeCurrencyLanguage:   true,
+		nfp.TokenTypeDecimalPoint:       true,
+		nfp.TokenTypeLiteral:            true,
+		nfp.TokenTypeRepeatsChar:        true,
+		nfp.TokenTypeTextPlaceHolder:    true,
+		nfp.TokenTypeThousandsSeparator: true,
+	}
+)
+
+// numberFormatter renders numbers with the cell's number format the way
+// excelize renders the same cells of an XLSX. Fractions, conditions and
+// other formats it does not render read as General.
+type numberFormatter struct {
+	date1904 bool
+	// xfs maps each XF record, in order, to its number format
+	xfs []uint16
+	// codes are the number formats defined in the workbook
+	codes    map[uint16]string
+	sections map[uint16][]nfp.Section
+}
+
+func newNumberFormatter() *numberFormatter {
+	return &numberFormatter{
+		codes:    make(map[uint16]string),
+		sections: make(map[uint16][]nfp.Section),
+	}
+}
+
+func (n *numberFormatter) format(value float64, xf uint16) string {
+	var numFmt uint16
+	if int(xf) < len(n.xfs) {
+		numFmt = n.xfs[xf]
+	}
+	sections, ok := n.sections[numFmt]
+	if !ok {
+		code, custom := n.codes[numFmt]
+		if !custom {
+			code = builtInFormats[numFmt]
+		}
+		parser := nfp.NumberFormatParser()
+		sections = parser.Parse(code)
+		n.sections[numFmt] = sections
+	}
+	return formatNumber(value, sections, n.date1904)
+}
+
+// generalNumber is a number as the General format shows it: in full, or
+// to 15 significant digits when it has more
+func generalNumber(value float64) string {
+	text := strconv.FormatFloat(value, 'f', -1, 64)
+	if len(strings.ReplaceAll(text, ".", "")) > 15 {
+		return strconv.FormatFloat(value, 'G', 15, 64)
+	}
+	return text
+}
+
+// formatNumber renders value with the section of the format that applies
+// to it. Zero only has a section of its own when the format has three.
+func formatNumber(value float64, sections []nfp.Section, date1904 bool) string {
+	general := generalNumber(value)
+	number, _ := strconv.ParseFloat(general, 64)
+
+	sectionType, negative := nfp.TokenSectionZero, false
+	switch {
+	case number > 0:
+		sectionType = nfp.TokenSectionPositive
+	case number < 0:
+		sectionType, negative = nfp.TokenSectionPositive, true
+		for _, section := range sections {
+			if section.Type == nfp.TokenSectionNegative {
+				sectionType, negative = nfp.TokenSectionNegative, false
+			}
+		}
+	}
+	for _, section := range sections {
+		if section.Type != sectionType {
+			continue
+		}
+		f := &sectionFormat{items: section.Items, number: number, general: general, negative: negative, date1904: date1904}
+		if sectionType == nfp.TokenSectionZero {
+			return general
+		}
+		return f.render()
+	}
+	return general
+}
+
+// sectionFormat renders a number with one section of a number format
+type sectionFormat struct {
+	items    []nfp.Token
+	number   float64
+	general  string
+	negative bool
+	date1904 bool
+
+	t       time.Time
+	ap      string
+	millis  bool
+	builder strings.Builder
+}
+
+func (f *sectionFormat) render() string {
+	numeric := false
+	for _, token := range f.items {
+		switch {
+		case numberTokens[token.TType]:
+			numeric = true
+		case dateTokens[token.TType]:
+			if numeric || f.number < 0 {
+				return f.general
+			}
+			return f.date()
+		case !decorationTokens[token.TType]:
+			return f.general
+		}
+	}
+	return f.numeric()
+}
+
+// numeric renders the number with the placeholders, thousands separator,
+// percent signs and exponent of the section
+func (f *sectionFormat) numeric() string {
+	var (
+		intHolder, fracHolder, intPadding, fracPadding, expBaseLen, percent int
+		pointer, commaSep, scientific                                       bool
+	)
+	for _, token := range f.items {
+		switch token.TType {
+		case nfp.TokenTypeHashPlaceHolder:
+			if pointer {
+				fracHolder += len(token.TValue)
+			} else {
+				intHolder += len(token.TValue)
+			}
+		case nfp.TokenTypeExponential:
+			scientific = true
+		case nfp.TokenTypeThousandsSeparator:
+			commaSep = true
+		case nfp.TokenTypePercent:
+			percent += len(token.TValue)
+		case nfp.TokenTypeDecimalPoint:
+			pointer = true
+		case nfp.TokenTypeZeroPlaceHolder:
+			intHolder = 0
+			switch {
+			case pointer && scientific:
+				expBaseLen += len(token.TValue)
+			case pointer:
+				fracPadding += len(token.TValue)
+			default:
+				intPadding += len(token.TValue)
+			}
+		}
+	}
+
+	whole, frac, _ := strings.Cut(strconv.FormatFloat(math.Abs(f.number), 'f', -1, 64), ".")
+	intPart, fracPart := len(whole), len(frac)
+	intHolder = min(intHolder, intPart)
+	intLen := max(intPart, intPadding+intHolder)
+	fracLen := min(fracPart, fracHolder+fracPadding)
+	if fracPadding > fracPart {
+		fracLen = fracPadding
+	}
+
+	// Numbers General shows to 15 digits are padded with zeros, not
+	// printed with the float's binary noise
+	if digits := strconv.FormatFloat(f.number, 'f', -1, 64); len(strings.ReplaceAll(digits, ".", "")) > 15 && intLen+fracLen > 15 && !scientific {
+		return f.literals(f.bigNumber(fracLen, percent > 0, commaSep))
+	}
+	width := intLen + fracLen
+	if fracLen > 0 {
+		width++
+	}
+	layout := fmt.Sprintf("%%0%d.%df%s", width, fracLen, strings.Repeat("%%", percent))
+	if scientific {
+		if expBaseLen != 2 {
+			return f.general
+		}
+		layout = fmt.Sprintf("%%.%dE%s", fracLen, strings.Repeat("%%", percent))
+	}
+	number := math.Abs(f.number) * math.Pow(100, float64(percent))
+	text := fmt.Sprintf(layout, number)
+	if commaSep {
+		text = thousands(text)
+	}
+	return f.literals(text)
+}
+
+// bigNumber renders a number of more than 15 digits from its decimal
+// digits, with at most one percent sign
+func (f *sectionFormat) bigNumber(fracLen int, percent, commaSep bool) string {
+	number := math.Abs(f.number)
+	if percent {
+		number *= 100
+	}
+	text := strconv.FormatFloat(number, 'f', -1, 64)
+	if commaSep {
+		text = thousands(text)
+	}
+	if fracLen > 0 {
+		whole, frac, _ := strings.Cut(text, ".")
+		if len(frac) < fracLen {
+			frac += strings.Repeat("0", fracLen-len(frac))
+		}
+		text = whole + "." + frac[:fracLen]
+	}
+	if percent {
+		text += "%"
+	}
+	return text
+}
+
+// literals places the rendered number among the literals of the section.
+// Literals between placeholders are not supported.
+func (f *sectionFormat) literals(text string) string {
+	var result strings.Builder
+	if f.negative {
+		result.WriteString("-")
+	}
+	placed, literalAfter := false, false
+	for _, token := range f.items {
+		switch token.TType {
+		case nfp.TokenTypeCurrencyLanguage:
+			result.WriteString(currency(token))
+		case nfp.TokenTypeLiteral:
+			literalAfter = placed
+			result.WriteString(token.TValue)
+		case nfp.TokenTypeHashPlaceHolder, nfp.TokenTypeZeroPlaceHolder:
+			if literalAfter {
+				return f.general
+			}
+			if !placed {
+				placed = true
+				result.WriteString(text)
+			}
+		}
+	}
+	return result.String()
+}
+
+// currency is the currency symbol of a [$₹-4009] token
+func currency(token nfp.Token) string {
+	for _, part := range token.Parts {
+		if part.Token.TType == nfp.TokenSubTypeCurrencyString {
+			return part.Token.TValue
+		}
+	}
+	return ""
+}
+
+// thousands separates the thousands of the integer part of text
+func thousands(text string) string {
+	whole, frac, hasFrac := strings.Cut(text, ".")
+	var result strings.Builder
+	for i := 0; i < len(whole); i++ {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			result.WriteString(",")
+		}
+		result.WriteByte(whole[i])
+	}
+	if hasFrac {
+		result.WriteString(".")
+		result.WriteString(frac)
+	}
+	return result.String()
+}
+
+// excelTime converts a date serial to a time. Like excelize, it keeps the
+// microseconds of the first 61 days and rounds later times to the second.
+func excelTime(serial float64, date1904 bool) time.Time {
+	epoch := excel1900Epoch
+	if date1904 {
+		epoch = excel1904Epoch
+	}
+	days := int(serial)
+	date := epoch.AddDate(0, 0, days)
+	if days <= 61 {
+		nanos := int64(float64(24*time.Hour)*(serial-float64(days)) + 500)
+		return date.Add(time.Duration(nanos - nanos%1000))
+	}
+	t := date.Add(time.Duration((serial - float64(days) + 1e-9) * float64(24*time.Hour)))
+	if t.Nanosecond()/1e6 > 500 {
+		return t.Round(time.Second)
+	}
+	return t.Truncate(time.Second)
+}
+
+// date renders the number as a date and time. Zero placeholders after the
+// seconds show milliseconds; any other number token reads as General.
+func (f *sectionFormat) date() string {
+	dates := false
+	for _, token := range f.items {
+		if dateTokens[token.TType] {
+			if dates && f.millis {
+				return f.general
+			}
+			dates = true
+		}
+		if numberTokens[token.TType] {
+			if token.TType != nfp.TokenTypeZeroPlaceHolder {
+				return f.general
+			}
+			f.millis = true
+		}
+	}
+
+	f.t = excelTime(f.number, f.date1904)
+	if !f.millis {
+		f.t = f.t.Add(time.Duration(math.Round(float64(f.t.Nanosecond())/1e9)) * time.Second)
+	}
+	for i, token := range f.items {
+		switch token.TType {
+		case nfp.TokenTypeCurrencyLanguage:
+			f.builder.WriteString(currency(token))
+		case nfp.TokenTypeDateTimes:
+			f.dateTime(i, token.TValue)
+		case nfp.TokenTypeElapsedDateTimes:
+			f.elapsed(token.TValue)
+		case nfp.TokenTypeLiteral:
+			f.builder.WriteString(token.TValue)
+		case nfp.TokenTypeDecimalPoint:
+			f.builder.WriteString(".")
+		case nfp.TokenTypeZeroPlaceHolder:
+			f.builder.WriteString(fmt.Sprintf("%03d", f.t.Nanosecond()/1e6)[:min(len(token.TValue), 3)])
+		}
+	}
+	return f.builder.String()
+}
+
+func (f *sectionFormat) dateTime(i int, value string) {
+	upper := strings.ToUpper(value)
+	if upper == "AM/PM" || upper == "A/P" {
+		if f.ap == "" {
+			aps := strings.Split(value, "/")
+			f.ap = aps[0]
+			if f.hoursNext(i) >= 12 {
+				f.ap = aps[1]
+			}
+		}
+		f.builder.WriteString(f.ap)
+		return
+	}
+	switch {
+	case strings.Contains(upper, "M") && len(value) <= 2 && f.isMonth(i):
+		f.builder.WriteString(twoDigits(int(f.t.Month()), len(value)))
+	case strings.Contains(upper, "M") && len(value) == 3:
+		f.builder.WriteString(f.t.Month().String()[:3])
+	case strings.Contains(upper, "M") && len(value) == 5:
+		f.builder.WriteString(f.t.Month().String()[:1])
+	case strings.Contains(upper, "M") && len(value) > 3:
+		f.builder.WriteString(f.t.Month().String())
+	case strings.Contains(upper, "Y"):
+		year := strconv.Itoa(f.t.Year())
+		if len(value) <= 2 {
+			year = year[2:]
+		}
+		f.builder.WriteString(year)
+	case strings.Contains(upper, "A"):
+		if len(value) == 3 {
+			f.builder.WriteString(f.t.Weekday().String()[:3])
+		} else if len(value) > 3 {
+			f.builder.WriteString(f.t.Weekday().String())
+		}
+	case strings.Contains(upper, "D"):
+		switch len(value) {
+		case 1, 2:
+			f.builder.WriteString(twoDigits(f.t.Day(), len(value)))
+		case 3:
+			f.builder.WriteString(f.t.Weekday().String()[:3])
+		default:
+			f.builder.WriteString(f.t.Weekday().String())
+		}
+	case strings.Contains(upper, "H"):
+		f.builder.WriteString(twoDigits(f.hour(i), len(value)))
+	case strings.Contains(upper, "M"):
+		f.builder.WriteString(twoDigits(f.t.Minute(), len(value)))
+	case strings.Contains(upper, "S"):
+		f.builder.WriteString(twoDigits(f.t.Second(), len(value)))
+	}
+}
+
+// hour is the hour on a 12-hour clock when an AM/PM follows
+func (f *sectionFormat) hour(i int) int {
+	h := f.t.Hour()
+	if aps, ok := f.apNext(i); ok {
+		f.ap = aps[0]
+		if h >= 12 {
+			f.ap = aps[1]
+		}
+		if h > 12 {
+			h -= 12
+		}
+	}
+	if f.ap != "" {
+		if f.hoursNext(i) == -1 && h > 12 {
+			h -= 12
+		}
+		if h == 0 {
+			h = 12
+		}
+	}
+	return h
+}
+
+func (f *sectionFormat) elapsed(value string) {
+	since := f.t.Sub(excel1900Epoch)
+	switch upper := strings.ToUpper(value); {
+	case strings.Contains(upper, "H"):
+		f.builder.WriteString(fmt.Sprintf("%.f", math.Floor(since.Hours())))
+	case strings.Contains(upper, "M"):
+		f.builder.WriteString(fmt.Sprintf("%.f", math.Floor(since.Minutes())))
+	case strings.Contains(upper, "S"):
+		f.builder.WriteString(fmt.Sprintf("%.f", math.Floor(since.Seconds())))
+	}
+}
+
+// hoursNext is the hour when an hours token follows token i, or -1
+func (f *sectionFormat) hoursNext(i int) int {
+	for _, token := range f.items[i+1:] {
+		if token.TType == nfp.TokenTypeDateTimes && strings.Contains(strings.ToUpper(token.TValue), "H") {
+			return excelTime(f.number, false).Hour()
+		}
+	}
+	return -1
+}
+
+// apNext returns the AM/PM names when one follows token i before the next
+// hours token
+func (f *sectionFormat) apNext(i int) ([]string, bool) {
+	for _, token := range f.items[i+1:] {
+		if token.TType != nfp.TokenTypeDateTimes {
+			continue
+		}
+		if strings.Contains(strings.ToUpper(token.TValue), "H") {
+			return nil, false
+		}
+		if token.TValue == "AM/PM" || token.TValue == "A/P" {
+			return strings.Split(token.TValue, "/"), true
+		}
+	}
+	return nil, false
+}
+
+// isMonth tells an m or mm token that is a month from one that is minutes:
+// minutes follow hours or come before seconds
+func (f *sectionFormat) isMonth(i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		if token := f.items[j]; token.TType == nfp.TokenTypeDateTimes {
+			if strings.ContainsAny(strings.ToUpper(token.TValue), "HS") {
+				return false
+			}
+			break
+		} else if token.TType == nfp.TokenTypeElapsedDateTimes {
+			return false
+		}
+	}
+	for _, token := range f.items[i+1:] {
+		if token.TType == nfp.TokenTypeDateTimes {
+			return !strings.Contains(strings.ToUpper(token.TValue), "S")
+		}
+	}
+	return true
+}
+
+// twoDigits writes n as is for a one-letter token and padded to two digits
+// otherwise
+func twoDigits(n, letters int) string {
+	if letters == 1 {
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%02d", n)
+}
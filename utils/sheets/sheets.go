@@ -0,0 +1,84 @@
+// Package sheets reads the rows of portfolio files the same way whatever
+// their format: XLSX workbooks, legacy XLS (BIFF8) workbooks and CSV files.
+package sheets
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"stockbackend/utils/upload"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for files that are not XLSX, XLS or CSV
+	ErrUnsupportedFormat = errors.New("unsupported workbook format")
+	// ErrSheetTooLarge is returned when a sheet has more rows than allowed
+	ErrSheetTooLarge = errors.New("sheet exceeds the row limit")
+)
+
+// Workbook is a file of one or more sheets of rows. Cells are read as the
+// text a spreadsheet would display, so a number formatted as a percentage
+// reads "6.50%" whatever the format of the file.
+type Workbook interface {
+	// Format is the kind of file: upload.KindXLSX, KindXLS or KindCSV
+	Format() string
+	// Sheets lists the sheet names in workbook order
+	Sheets() []string
+	// Rows streams the rows of a sheet to fn one at a time until fn
+	// returns false. Rows may be called again to reread a sheet.
+	Rows(sheet string, fn func(row []string) bool) error
+	Close() error
+}
+
+// Options bound how much of a workbook is read. Zero means no limit
+// beyond the format's own.
+type Options struct {
+	// UnzipSizeLimit and UnzipXMLSizeLimit bound how much of an XLSX
+	// workbook is unzipped
+	UnzipSizeLimit    int64
+	UnzipXMLSizeLimit int64
+	// MaxFileBytes caps the workbook stream read from an XLS file
+	MaxFileBytes int64
+	// MaxRows and MaxColumns bound the cells kept from an XLS sheet, which
+	// is read whole: cells past MaxColumns are dropped and sheets longer
+	// than MaxRows fail with ErrSheetTooLarge
+	MaxRows    int
+	MaxColumns int
+}
+
+// Open reads the file at path, telling its format from its content rather
+// than its extension. A CSV file is a single sheet named after the file.
+func Open(path string, opts Options) (Workbook, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 8192)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		file.Close()
+		return nil, err
+	}
+	kind, err := upload.Sniff(head[:n])
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, path)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	switch kind {
+	case upload.KindCSV:
+		return OpenCSV(file, sheetName(path))
+	case upload.KindXLS:
+		defer file.Close()
+		return OpenXLS(file, opts)
+	default:
+		file.Close()
+		return OpenXLSX(path, opts)
+	}
+}
@@ -0,0 +1,529 @@
+package sheets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	"stockbackend/utils/holdings"
+	"stockbackend/utils/upload"
+
+	"github.com/xuri/excelize/v2"
+	"github.com/xuri/nfp"
+)
+
+func readAll(t *testing.T, w Workbook, sheet string) [][]string {
+	t.Helper()
+	var rows [][]string
+	if err := w.Rows(sheet, func(row []string) bool {
+		rows = append(rows, row)
+		return true
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return rows
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// biffRecord encodes one BIFF8 record
+func biffRecord(kind uint16, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	out := binary.LittleEndian.AppendUint16(nil, kind)
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(body)))
+	return append(out, body...)
+}
+
+func u16(values ...uint16) []byte {
+	var out []byte
+	for _, v := range values {
+		out = binary.LittleEndian.AppendUint16(out, v)
+	}
+	return out
+}
+
+func u32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+func f64(v float64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v))
+}
+
+// wide encodes a string as UTF-16 with its options byte
+func wide(s string) []byte {
+	out := []byte{0x01}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, unit)
+	}
+	return out
+}
+
+// compoundFile wraps a workbook stream in a minimal OLE2 container with
+// 512-byte sectors: the FAT, the directory, then the stream
+func compoundFile(stream []byte) []byte {
+	const sector = 512
+	if len(stream) < 4096 {
+		// Shorter streams would belong in the mini stream
+		stream = append(stream, make([]byte, 4096-len(stream))...)
+	}
+	streamSectors := (len(stream) + sector - 1) / sector
+
+	header := make([]byte, sector)
+	copy(header, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+	copy(header[24:], u16(0x003E, 0x0003, 0xFFFE, 0x0009, 0x0006))
+	copy(header[44:], u32(1))          // FAT sectors
+	copy(header[48:], u32(1))          // first directory sector
+	copy(header[56:], u32(4096))       // mini stream cutoff
+	copy(header[60:], u32(0xFFFFFFFE)) // no mini FAT
+	copy(header[68:], u32(0xFFFFFFFE)) // no DIFAT sectors
+	for i := 0; i < 109; i++ {
+		copy(header[76+4*i:], u32(0xFFFFFFFF))
+	}
+	copy(header[76:], u32(0))
+
+	fat := bytes.Repeat([]byte{0xFF}, sector)
+	copy(fat, u32(0xFFFFFFFD))
+	copy(fat[4:], u32(0xFFFFFFFE))
+	for i := 0; i < streamSectors; i++ {
+		next := uint32(i + 3)
+		if i == streamSectors-1 {
+			next = 0xFFFFFFFE
+		}
+		copy(fat[4*(i+2):], u32(next))
+	}
+
+	entry := func(name string, kind byte, child, start uint32, size int) []byte {
+		out := make([]byte, 128)
+		units := utf16.Encode([]rune(name))
+		for i, unit := range units {
+			copy(out[2*i:], u16(unit))
+		}
+		copy(out[64:], u16(uint16(2*len(units)+2)))
+		out[66], out[67] = kind, 1
+		copy(out[68:], u32(0xFFFFFFFF))
+		copy(out[72:], u32(0xFFFFFFFF))
+		copy(out[76:], u32(child))
+		copy(out[116:], u32(start))
+		copy(out[120:], u32(uint32(size)))
+		return out
+	}
+	directory := bytes.Join([][]byte{
+		entry("Root Entry", 5, 1, 0xFFFFFFFE, 0),
+		entry("Workbook", 2, 0xFFFFFFFF, 2, len(stream)),
+		entry("", 0, 0xFFFFFFFF, 0, 0),
+		entry("", 0, 0xFFFFFFFF, 0, 0),
+	}, nil)
+
+	padded := append(stream, make([]byte, streamSectors*sector-len(stream))...)
+	return bytes.Join([][]byte{header, fat, directory, padded}, nil)
+}
+
+// holdingsXLS builds a workbook with one "Equity" sheet holding a small
+// portfolio: shared strings, a percentage NUMBER, RK and MULRK integers and
+// a formula with a text result
+func holdingsXLS() []byte {
+	bof := func(kind uint16) []byte { return biffRecord(recordBOF, u16(biff8Version, kind), make([]byte, 12)) }
+	cell := func(row, col, xf uint16) []byte { return u16(row, col, xf) }
+
+	// The last string is cut by a CONTINUE that switches it to UTF-16
+	sst := biffRecord(recordSST, u32(4), u32(4),
+		u16(4), []byte{0}, []byte("ISIN"),
+		u16(4), []byte{0}, []byte("Name"),
+		u16(8), []byte{0}, []byte("% to NAV"),
+		u16(8), []byte{0}, []byte("Nestl"),
+	)
+	sst = append(sst, biffRecord(recordContinue, wide("é I"))...)
+
+	globals := bytes.Join([][]byte{
+		bof(0x0005),
+		biffRecord(recordFormat, u16(164, 6), []byte{0}, []byte("0.000%")),
+		biffRecord(recordXF, u16(0, 0), make([]byte, 16)),   // 0: General
+		biffRecord(recordXF, u16(0, 10), make([]byte, 16)),  // 1: 0.00%
+		biffRecord(recordXF, u16(0, 164), make([]byte, 16)), // 2: 0.000%
+		biffRecord(recordXF, u16(0, 3), make([]byte, 16)),   // 3: #,##0
+		biffRecord(recordBoundSheet, u32(0), []byte{0, 0}, []byte{6, 0}, []byte("Equity")),
+		sst,
+		biffRecord(recordEOF),
+	}, nil)
+	// The sheet starts right after the globals; BOUNDSHEET keeps its
+	// offset 8 bytes before the sheet name
+	offset := bytes.Index(globals, []byte("Equity")) - 8
+	copy(globals[offset:], u32(uint32(len(globals))))
+
+	rk := func(v int32) []byte { return u32(uint32(v)<<2 | 0x02) }
+	sheet := bytes.Join([][]byte{
+		bof(0x0010),
+		biffRecord(recordLabelSST, cell(0, 0, 0), u32(0)),
+		biffRecord(recordLabelSST, cell(0, 1, 0), u32(1)),
+		biffRecord(recordLabelSST, cell(0, 2, 0), u32(2)),
+		biffRecord(recordLabel, cell(0, 3, 0), u16(8), []byte{0}, []byte("Quantity")),
+		biffRecord(recordLabel, cell(2, 0, 0), u16(12), []byte{0}, []byte("INE239A01024")),
+		biffRecord(recordLabelSST, cell(2, 1, 0), u32(3)),
+		biffRecord(recordNumber, cell(2, 2, 1), f64(0.0655)),
+		biffRecord(recordRK, cell(2, 3, 3), rk(1234567)),
+		biffRecord(recordFormula, cell(3, 0, 0), []byte{formulaString, 0, 0, 0, 0, 0, 0xFF, 0xFF}, make([]byte, 6)),
+		biffRecord(recordString, u16(12), []byte{0}, []byte("INE009A01021")),
+		biffRecord(recordMulRK, u16(3, 2), u16(2), u32(0x3FF00000), u16(0), rk(42), u16(3)),
+		biffRecord(recordEOF),
+	}, nil)
+	return compoundFile(append(globals, sheet...))
+}
+
+func TestOpen_XLS(t *testing.T) {
+	w, err := Open(writeFile(t, "portfolio.xls", holdingsXLS()), Options{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer w.Close()
+
+	if w.Format() != "xls" || !reflect.DeepEqual(w.Sheets(), []string{"Equity"}) {
+		t.Fatalf("Expected one xls sheet named Equity, got %v %v", w.Format(), w.Sheets())
+	}
+	expected := [][]string{
+		{"ISIN", "Name", "% to NAV", "Quantity"},
+		nil,
+		{"INE239A01024", "Nestlé I", "6.55%", "1,234,567"},
+		{"INE009A01021", "", "100.000%", "42"},
+	}
+	if rows := readAll(t, w, "Equity"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %q, got %q", expected, rows)
+	}
+}
+
+func TestOpen_XLSLimits(t *testing.T) {
+	path := writeFile(t, "portfolio.xls", holdingsXLS())
+
+	w, err := Open(path, Options{MaxColumns: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := [][]string{{"ISIN", "Name"}, nil, {"INE239A01024", "Nestlé I"}, {"INE009A01021"}}
+	if rows := readAll(t, w, "Equity"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %q, got %q", expected, rows)
+	}
+
+	w, err = Open(path, Options{MaxRows: 3})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := w.Rows("Equity", func([]string) bool { return true }); !errors.Is(err, ErrSheetTooLarge) {
+		t.Errorf("Expected ErrSheetTooLarge, got %v", err)
+	}
+
+	if _, err := Open(path, Options{MaxFileBytes: 1024}); !errors.Is(err, upload.ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge, got %v", err)
+	}
+}
+
+// TestOpen_SameRows checks that a sheet saved as XLSX and as XLS reads the
+// same, number formats included
+func TestOpen_SameRows(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Equity")
+	percent, _ := f.NewStyle(&excelize.Style{NumFmt: 10})
+	custom := "0.000%"
+	precise, _ := f.NewStyle(&excelize.Style{CustomNumFmt: &custom})
+	thousands, _ := f.NewStyle(&excelize.Style{NumFmt: 3})
+	f.SetSheetRow("Equity", "A1", &[]interface{}{"ISIN", "Name", "% to NAV", "Quantity"})
+	f.SetSheetRow("Equity", "A3", &[]interface{}{"INE239A01024", "Nestlé I", 0.0655, 1234567})
+	f.SetCellValue("Equity", "A4", "INE009A01021")
+	f.SetCellValue("Equity", "C4", 1)
+	f.SetCellValue("Equity", "D4", 42)
+	f.SetCellStyle("Equity", "C3", "C3", percent)
+	f.SetCellStyle("Equity", "C4", "C4", precise)
+	f.SetCellStyle("Equity", "D3", "D3", thousands)
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	xlsx, err := Open(writeFile(t, "portfolio.xlsx", buf.Bytes()), Options{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer xlsx.Close()
+	xls, err := Open(writeFile(t, "portfolio.xls", holdingsXLS()), Options{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer xls.Close()
+
+	expected := readAll(t, xlsx, "Equity")
+	if rows := readAll(t, xls, "Equity"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected XLS rows %q, got %q", expected, rows)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		code     string
+		value    float64
+		expected string
+	}{
+		{"General", 0.0655, "0.0655"},
+		{"General", 0.1 + 0.2, "0.3"},
+		{"0.00%", 0.0655, "6.55%"},
+		{"0.00%", -0.0009, "-0.09%"},
+		{"0.00%", 0, "0"},
+		{"#,##0", 1234567, "1,234,567"},
+		{"#,##0.00;(#,##0.00)", -20, "(20.00)"},
+		{`#,##0.00 "Cr"`, 1450.25, "1,450.25 Cr"},
+		{"[$₹-4009] #,##0.00", 1450.25, "₹ 1,450.25"},
+		{"0.00E+00", 1234567, "1.23E+06"},
+		{"dd-mmm-yyyy", 45382, "31-Mar-2024"},
+		{"mm-dd-yy", 45382, "03-31-24"},
+		{"h:mm AM/PM", 45382.75, "6:00 PM"},
+		{"# ?/?", 0.5, "0.5"},
+	}
+	for _, test := range tests {
+		parser := nfp.NumberFormatParser()
+		if got := formatNumber(test.value, parser.Parse(test.code), false); got != test.expected {
+			t.Errorf("Expected %q for %v as %q, got %q", test.expected, test.value, test.code, got)
+		}
+	}
+
+	parser := nfp.NumberFormatParser()
+	if got := formatNumber(43920, parser.Parse("dd-mmm-yyyy"), true); got != "31-Mar-2024" {
+		t.Errorf("Expected %q with 1904 dates, got %q", "31-Mar-2024", got)
+	}
+}
+
+// disclosureXLS builds the same workbook as the XLSX and CSV copies in
+// TestOpen_SameHoldings from LABEL, NUMBER and RK cells
+func disclosureXLS() []byte {
+	bof := func(kind uint16) []byte { return biffRecord(recordBOF, u16(biff8Version, kind), make([]byte, 12)) }
+	label := func(row, col uint16, value string) []byte {
+		return biffRecord(recordLabel, u16(row, col, 0), u16(uint16(len(value))), []byte{0}, []byte(value))
+	}
+	number := func(row, col, xf uint16, value float64) []byte {
+		return biffRecord(recordNumber, u16(row, col, xf), f64(value))
+	}
+	format := func(id uint16, code string) []byte {
+		return biffRecord(recordFormat, u16(id, uint16(len(code))), []byte{0}, []byte(code))
+	}
+	xf := func(numFmt uint16) []byte { return biffRecord(recordXF, u16(0, numFmt), make([]byte, 16)) }
+
+	globals := bytes.Join([][]byte{
+		bof(0x0005),
+		format(164, "dd-mmm-yyyy"),
+		format(165, "#,##0.00;(#,##0.00)"),
+		xf(0), xf(3), xf(4), xf(10), xf(164), xf(165),
+		biffRecord(recordBoundSheet, u32(0), []byte{0, 0}, []byte{6, 0}, []byte("Equity")),
+		biffRecord(recordEOF),
+	}, nil)
+	offset := bytes.Index(globals, []byte("Equity")) - 8
+	copy(globals[offset:], u32(uint32(len(globals))))
+
+	sheet := bytes.Join([][]byte{
+		bof(0x0010),
+		label(0, 0, "HDFC Flexi Cap Fund"),
+		label(1, 0, "Portfolio as on"),
+		number(1, 1, 4, 45382),
+		label(3, 0, "Name of the Instrument"),
+		label(3, 1, "ISIN"),
+		label(3, 2, "Industry / Rating"),
+		label(3, 3, "Quantity"),
+		label(3, 4, "Market/Fair Value (Rs. in Lacs.)"),
+		label(3, 5, "% to NAV"),
+		label(4, 0, "EQUITY & EQUITY RELATED"),
+		label(5, 0, "HDFC Bank Limited"),
+		label(5, 1, "INE040A01034"),
+		label(5, 2, "Banks"),
+		number(5, 3, 1, 1000),
+		number(5, 4, 2, 1450.25),
+		number(5, 5, 3, 0.065),
+		label(6, 0, "Infosys Limited"),
+		label(6, 1, "INE009A01021"),
+		label(6, 2, "IT - Software"),
+		biffRecord(recordRK, u16(6, 3, 1), u32(500<<2|0x02)),
+		number(6, 4, 2, 720.1),
+		number(6, 5, 3, 0.0325),
+		label(7, 0, "Net Receivables / (Payables)"),
+		number(7, 4, 5, -20),
+		number(7, 5, 3, -0.0009),
+		label(8, 0, "GRAND TOTAL (AUM)"),
+		number(8, 4, 2, 2150.35),
+		number(8, 5, 3, 1),
+		biffRecord(recordEOF),
+	}, nil)
+	return compoundFile(append(globals, sheet...))
+}
+
+// TestOpen_SameHoldings checks that XLSX, XLS and CSV copies of a
+// disclosure give the same holdings and fund details
+func TestOpen_SameHoldings(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Equity")
+	style := func(numFmt int, custom string) int {
+		spec := &excelize.Style{NumFmt: numFmt}
+		if custom != "" {
+			spec = &excelize.Style{CustomNumFmt: &custom}
+		}
+		id, _ := f.NewStyle(spec)
+		return id
+	}
+	thousands, amount, percent := style(3, ""), style(4, ""), style(10, "")
+	date, signed := style(0, "dd-mmm-yyyy"), style(0, "#,##0.00;(#,##0.00)")
+	f.SetCellValue("Equity", "A1", "HDFC Flexi Cap Fund")
+	f.SetSheetRow("Equity", "A2", &[]interface{}{"Portfolio as on", 45382})
+	f.SetSheetRow("Equity", "A4", &[]interface{}{"Name of the Instrument", "ISIN", "Industry / Rating", "Quantity", "Market/Fair Value (Rs. in Lacs.)", "% to NAV"})
+	f.SetCellValue("Equity", "A5", "EQUITY & EQUITY RELATED")
+	f.SetSheetRow("Equity", "A6", &[]interface{}{"HDFC Bank Limited", "INE040A01034", "Banks", 1000, 1450.25, 0.065})
+	f.SetSheetRow("Equity", "A7", &[]interface{}{"Infosys Limited", "INE009A01021", "IT - Software", 500, 720.1, 0.0325})
+	f.SetCellValue("Equity", "A8", "Net Receivables / (Payables)")
+	f.SetSheetRow("Equity", "E8", &[]interface{}{-20, -0.0009})
+	f.SetCellValue("Equity", "A9", "GRAND TOTAL (AUM)")
+	f.SetSheetRow("Equity", "E9", &[]interface{}{2150.35, 1})
+	f.SetCellStyle("Equity", "B2", "B2", date)
+	f.SetCellStyle("Equity", "D6", "D7", thousands)
+	f.SetCellStyle("Equity", "E6", "E9", amount)
+	f.SetCellStyle("Equity", "E8", "E8", signed)
+	f.SetCellStyle("Equity", "F6", "F9", percent)
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	csv := "HDFC Flexi Cap Fund\n" +
+		"Portfolio as on,31-Mar-2024\n" +
+		"\n" +
+		"Name of the Instrument,ISIN,Industry / Rating,Quantity,Market/Fair Value (Rs. in Lacs.),% to NAV\n" +
+		"EQUITY & EQUITY RELATED\n" +
+		"HDFC Bank Limited,INE040A01034,Banks,\"1,000\",\"1,450.25\",6.50%\n" +
+		"Infosys Limited,INE009A01021,IT - Software,500,720.10,3.25%\n" +
+		"Net Receivables / (Payables),,,,(20.00),-0.09%\n" +
+		"GRAND TOTAL (AUM),,,,\"2,150.35\",100.00%\n"
+
+	files := map[string][]byte{
+		"Equity.xlsx": buf.Bytes(),
+		"Equity.xls":  disclosureXLS(),
+		"Equity.csv":  []byte(csv),
+	}
+	extracted := make(map[string]*holdings.Extractor)
+	for name, data := range files {
+		w, err := Open(writeFile(t, name, data), Options{})
+		if err != nil {
+			t.Fatalf("Expected no error for %v, got %v", name, err)
+		}
+		extractor := holdings.NewExtractor()
+		if err := w.Rows("Equity", extractor.AddRow); err != nil {
+			t.Fatalf("Expected no error for %v, got %v", name, err)
+		}
+		w.Close()
+		extracted[name] = extractor
+	}
+
+	expected := extracted["Equity.xlsx"]
+	if got := len(expected.Holdings()); got != 3 {
+		t.Fatalf("Expected 3 holdings, got %v", got)
+	}
+	if date := expected.FundInfo().AsOfDate; date != "2024-03-31" {
+		t.Errorf("Expected %q, got %q", "2024-03-31", date)
+	}
+	if weight := expected.Holdings()[0][holdings.FieldWeight]; weight != "6.50%" {
+		t.Errorf("Expected %q, got %v", "6.50%", weight)
+	}
+	for _, name := range []string{"Equity.xls", "Equity.csv"} {
+		if got := extracted[name].Holdings(); !reflect.DeepEqual(got, expected.Holdings()) {
+			t.Errorf("Expected %v holdings %v, got %v", name, expected.Holdings(), got)
+		}
+		if got := extracted[name].FundInfo(); got != expected.FundInfo() {
+			t.Errorf("Expected %v fund %+v, got %+v", name, expected.FundInfo(), got)
+		}
+	}
+}
+
+// TestOpen_LargeSheet checks that a sheet over the XML size limit is
+// spooled to a temp file instead of being held in memory
+func TestOpen_LargeSheet(t *testing.T) {
+	f := excelize.NewFile()
+	for row := 1; row <= 2000; row++ {
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		f.SetSheetRow("Sheet1", cell, &[]interface{}{fmt.Sprintf("INE%09d", row), "Holding", row})
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	path := writeFile(t, "large.xlsx", buf.Bytes())
+
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	w, err := Open(path, Options{UnzipSizeLimit: 16 << 20, UnzipXMLSizeLimit: 4 << 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if spooled, _ := os.ReadDir(tempDir); len(spooled) == 0 {
+		t.Errorf("Expected the sheet to be spooled to a temp file")
+	}
+	rows := readAll(t, w, "Sheet1")
+	if len(rows) != 2000 || rows[1999][0] != "INE000002000" {
+		t.Errorf("Expected 2000 rows ending with INE000002000, got %v rows", len(rows))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if spooled, _ := os.ReadDir(tempDir); len(spooled) != 0 {
+		t.Errorf("Expected the temp file to be removed on close, got %v", len(spooled))
+	}
+}
+
+func TestOpen_CSV(t *testing.T) {
+	content := "\xEF\xBB\xBFPortfolio of Axis Bluechip Fund as on 31-Mar-2024\n" +
+		"ISIN;Name;% to NAV;\n" +
+		"INE239A01024;\"Nestle; India\";6.55%;\n"
+	w, err := Open(writeFile(t, "axis bluechip.csv", []byte(content)), Options{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer w.Close()
+
+	if w.Format() != "csv" || !reflect.DeepEqual(w.Sheets(), []string{"axis bluechip"}) {
+		t.Fatalf("Expected one csv sheet named after the file, got %v %v", w.Format(), w.Sheets())
+	}
+	expected := [][]string{
+		{"Portfolio of Axis Bluechip Fund as on 31-Mar-2024"},
+		{"ISIN", "Name", "% to NAV"},
+		{"INE239A01024", "Nestle; India", "6.55%"},
+	}
+	for i := 0; i < 2; i++ {
+		if rows := readAll(t, w, "axis bluechip"); !reflect.DeepEqual(rows, expected) {
+			t.Errorf("Expected %q, got %q", expected, rows)
+		}
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	if _, err := Open(writeFile(t, "scan.pdf", []byte("%PDF-1.7\x00")), Options{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+
+	encrypted := bytes.Join([][]byte{
+		biffRecord(recordBOF, u16(biff8Version, 0x0005), make([]byte, 12)),
+		biffRecord(recordFilePass, make([]byte, 6)),
+		biffRecord(recordEOF),
+	}, nil)
+	if _, err := Open(writeFile(t, "locked.xls", compoundFile(encrypted)), Options{}); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Expected ErrEncrypted, got %v", err)
+	}
+
+	biff5 := biffRecord(recordBOF, u16(0x0500, 0x0005), make([]byte, 4))
+	if _, err := Open(writeFile(t, "old.xls", compoundFile(biff5)), Options{}); !errors.Is(err, ErrOldXLS) {
+		t.Errorf("Expected ErrOldXLS, got %v", err)
+	}
+}
@@ -0,0 +1,582 @@
+package sheets
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf16"
+
+	"stockbackend/utils/upload"
+
+	"github.com/richardlehane/mscfb"
+)
+
+var (
+	// ErrEncrypted is returned for password protected XLS workbooks
+	ErrEncrypted = errors.New("workbook is password protected")
+	// ErrOldXLS is returned for XLS workbooks saved before Excel 97
+	ErrOldXLS = errors.New("only Excel 97-2003 XLS workbooks are supported")
+	// errTruncated is returned for records that run past their stream
+	errTruncated = errors.New("truncated XLS record")
+)
+
+// BIFF8 record types read from the workbook stream
+const (
+	recordFormula    = 0x0006
+	recordEOF        = 0x000A
+	recordFilePass   = 0x002F
+	recordDateMode   = 0x0022
+	recordContinue   = 0x003C
+	recordBoundSheet = 0x0085
+	recordMulRK      = 0x00BD
+	recordXF         = 0x00E0
+	recordSST        = 0x00FC
+	recordLabelSST   = 0x00FD
+	recordNumber     = 0x0203
+	recordLabel      = 0x0204
+	recordBoolErr    = 0x0205
+	recordString     = 0x0207
+	recordRK         = 0x027E
+	recordFormat     = 0x041E
+	recordBOF        = 0x0809
+)
+
+const (
+	biff8Version   = 0x0600
+	sheetWorksheet = 0
+	maxXLSRows     = 65536
+	maxXLSColumns  = 256
+	formulaString  = 0
+	formulaBool    = 1
+	formulaError   = 2
+)
+
+// cellErrors are the texts of the error codes of BOOLERR and FORMULA cells
+var cellErrors = map[byte]string{
+	0x00: "#NULL!",
+	0x07: "#DIV/0!",
+	0x0F: "#VALUE!",
+	0x17: "#REF!",
+	0x1D: "#NAME?",
+	0x24: "#NUM!",
+	0x2A: "#N/A",
+}
+
+// xlsSheet is a worksheet read whole. err is returned when its rows are
+// read, so one sheet over the limits does not fail the workbook.
+type xlsSheet struct {
+	name string
+	rows [][]string
+	err  error
+}
+
+type xlsWorkbook struct {
+	sheets []xlsSheet
+}
+
+// OpenXLS reads a legacy Excel 97-2003 workbook within the limits of opts.
+// Cell values are read from the saved file, formulas included, and numbers
+// are formatted with the cell's number format so they read as they would
+// in an XLSX.
+func OpenXLS(r io.ReaderAt, opts Options) (Workbook, error) {
+	doc, err := mscfb.New(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		switch entry.Name {
+		case "Workbook":
+			// A corrupt sector chain can make a stream far longer than
+			// the file it is in
+			var stream io.Reader = entry
+			if opts.MaxFileBytes > 0 {
+				stream = io.LimitReader(entry, opts.MaxFileBytes+1)
+			}
+			data, err := io.ReadAll(stream)
+			if err != nil {
+				return nil, err
+			}
+			if opts.MaxFileBytes > 0 && int64(len(data)) > opts.MaxFileBytes {
+				return nil, fmt.Errorf("%w: workbook stream over %d bytes", upload.ErrFileTooLarge, opts.MaxFileBytes)
+			}
+			return parseBIFF(data, opts)
+		case "Book":
+			return nil, ErrOldXLS
+		}
+	}
+	return nil, fmt.Errorf("%w: no workbook stream", ErrUnsupportedFormat)
+}
+
+func (w *xlsWorkbook) Format() string {
+	return upload.KindXLS
+}
+
+func (w *xlsWorkbook) Sheets() []string {
+	names := make([]string, len(w.sheets))
+	for i, sheet := range w.sheets {
+		names[i] = sheet.name
+	}
+	return names
+}
+
+func (w *xlsWorkbook) Rows(sheet string, fn func(row []string) bool) error {
+	for _, s := range w.sheets {
+		if s.name != sheet {
+			continue
+		}
+		if s.err != nil {
+			return s.err
+		}
+		for _, row := range s.rows {
+			if !fn(row) {
+				return nil
+			}
+		}
+		return nil
+	}
+	return errors.New("sheet " + sheet + " does not exist")
+}
+
+func (w *xlsWorkbook) Close() error {
+	return nil
+}
+
+type record struct {
+	kind uint16
+	data []byte
+}
+
+// records splits a BIFF stream, from offset on, into records
+type records struct {
+	stream []byte
+	pos    int
+}
+
+func (r *records) next() (record, error) {
+	if r.pos+4 > len(r.stream) {
+		return record{}, io.EOF
+	}
+	kind := binary.LittleEndian.Uint16(r.stream[r.pos:])
+	size := int(binary.LittleEndian.Uint16(r.stream[r.pos+2:]))
+	start := r.pos + 4
+	if start+size > len(r.stream) {
+		return record{}, errTruncated
+	}
+	r.pos = start + size
+	return record{kind: kind, data: r.stream[start:r.pos]}, nil
+}
+
+// peek returns the type of the next record without reading it
+func (r *records) peek() uint16 {
+	if r.pos+2 > len(r.stream) {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(r.stream[r.pos:])
+}
+
+// boundSheet is a worksheet listed in the workbook globals
+type boundSheet struct {
+	name   string
+	offset int
+}
+
+// parseBIFF reads the workbook globals for the sheet list, shared strings
+// and number formats, then each worksheet's cells within the row and
+// column limits of opts
+func parseBIFF(stream []byte, opts Options) (*xlsWorkbook, error) {
+	maxRows, maxColumns := maxXLSRows, maxXLSColumns
+	if opts.MaxRows > 0 {
+		maxRows = min(maxRows, opts.MaxRows)
+	}
+	if opts.MaxColumns > 0 {
+		maxColumns = min(maxColumns, opts.MaxColumns)
+	}
+
+	numbers := newNumberFormatter()
+
+	var (
+		bound []boundSheet
+		sst   []string
+	)
+	globals := &records{stream: stream}
+	for {
+		rec, err := globals.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch rec.kind {
+		case recordBOF:
+			if len(rec.data) < 2 || binary.LittleEndian.Uint16(rec.data) != biff8Version {
+				return nil, ErrOldXLS
+			}
+		case recordFilePass:
+			return nil, ErrEncrypted
+		case recordDateMode:
+			numbers.date1904 = len(rec.data) >= 2 && binary.LittleEndian.Uint16(rec.data) == 1
+		case recordFormat:
+			if len(rec.data) < 2 {
+				return nil, errTruncated
+			}
+			code, _, err := unicodeString(rec.data[2:], 2)
+			if err != nil {
+				return nil, err
+			}
+			numbers.codes[binary.LittleEndian.Uint16(rec.data)] = code
+		case recordXF:
+			if len(rec.data) < 4 {
+				return nil, errTruncated
+			}
+			numbers.xfs = append(numbers.xfs, binary.LittleEndian.Uint16(rec.data[2:]))
+		case recordBoundSheet:
+			if len(rec.data) < 6 {
+				return nil, errTruncated
+			}
+			name, _, err := unicodeString(rec.data[6:], 1)
+			if err != nil {
+				return nil, err
+			}
+			if rec.data[5] == sheetWorksheet {
+				bound = append(bound, boundSheet{name: name, offset: int(binary.LittleEndian.Uint32(rec.data))})
+			}
+		case recordSST:
+			segments := [][]byte{rec.data}
+			for globals.peek() == recordContinue {
+				next, err := globals.next()
+				if err != nil {
+					return nil, err
+				}
+				segments = append(segments, next.data)
+			}
+			if sst, err = sharedStrings(segments); err != nil {
+				return nil, err
+			}
+		}
+		if rec.kind == recordEOF {
+			break
+		}
+	}
+
+	workbook := &xlsWorkbook{}
+	for _, sheet := range bound {
+		if sheet.offset < 0 || sheet.offset >= len(stream) {
+			return nil, errTruncated
+		}
+		rows, err := parseSheet(&records{stream: stream, pos: sheet.offset}, sst, numbers, maxRows, maxColumns)
+		if errors.Is(err, ErrSheetTooLarge) {
+			workbook.sheets = append(workbook.sheets, xlsSheet{name: sheet.name, err: fmt.Errorf("%w: %s has more than %d rows", err, sheet.name, maxRows)})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", sheet.name, err)
+		}
+		workbook.sheets = append(workbook.sheets, xlsSheet{name: sheet.name, rows: rows})
+	}
+	return workbook, nil
+}
+
+// parseSheet reads the cells of a worksheet substream into rows. Rows
+// missing between cells come out empty, like excelize does for XLSX. Cells
+// from column maxColumns on are dropped, and a cell from row maxRows on
+// stops the sheet with ErrSheetTooLarge.
+func parseSheet(r *records, sst []string, numbers *numberFormatter, maxRows, maxColumns int) ([][]string, error) {
+	var rows [][]string
+	tooLarge := false
+	set := func(row, col int, value string) {
+		if row >= maxRows {
+			tooLarge = tooLarge || value != ""
+			return
+		}
+		if col >= maxColumns || value == "" {
+			return
+		}
+		for len(rows) <= row {
+			rows = append(rows, nil)
+		}
+		for len(rows[row]) <= col {
+			rows[row] = append(rows[row], "")
+		}
+		rows[row][col] = value
+	}
+
+	// A formula whose result is text keeps it in the STRING record after it
+	pendingRow, pendingCol := -1, -1
+	for {
+		if tooLarge {
+			return nil, ErrSheetTooLarge
+		}
+		rec, err := r.next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data := rec.data
+		row, col := 0, 0
+		if len(data) >= 4 {
+			row, col = cellPos(data)
+		}
+		switch rec.kind {
+		case recordEOF:
+			return rows, nil
+		case recordLabelSST:
+			if len(data) < 10 {
+				return nil, errTruncated
+			}
+			if index := int(binary.LittleEndian.Uint32(data[6:])); index < len(sst) {
+				set(row, col, sst[index])
+			}
+		case recordLabel:
+			if len(data) < 6 {
+				return nil, errTruncated
+			}
+			value, _, err := unicodeString(data[6:], 2)
+			if err != nil {
+				return nil, err
+			}
+			set(row, col, value)
+		case recordNumber:
+			if len(data) < 14 {
+				return nil, errTruncated
+			}
+			value := math.Float64frombits(binary.LittleEndian.Uint64(data[6:]))
+			set(row, col, numbers.format(value, cellXF(data)))
+		case recordRK:
+			if len(data) < 10 {
+				return nil, errTruncated
+			}
+			value := decodeRK(binary.LittleEndian.Uint32(data[6:]))
+			set(row, col, numbers.format(value, cellXF(data)))
+		case recordMulRK:
+			if len(data) < 6 {
+				return nil, errTruncated
+			}
+			for i := 4; i+6 <= len(data)-2; i += 6 {
+				xf := binary.LittleEndian.Uint16(data[i:])
+				value := decodeRK(binary.LittleEndian.Uint32(data[i+2:]))
+				set(row, col, numbers.format(value, xf))
+				col++
+			}
+		case recordBoolErr:
+			if len(data) < 8 {
+				return nil, errTruncated
+			}
+			set(row, col, boolOrError(data[6], data[7] == 1))
+		case recordFormula:
+			if len(data) < 14 {
+				return nil, errTruncated
+			}
+			result := data[6:14]
+			if result[6] != 0xFF || result[7] != 0xFF {
+				value := math.Float64frombits(binary.LittleEndian.Uint64(result))
+				set(row, col, numbers.format(value, cellXF(data)))
+				continue
+			}
+			switch result[0] {
+			case formulaString:
+				pendingRow, pendingCol = row, col
+			case formulaBool:
+				set(row, col, boolOrError(result[2], false))
+			case formulaError:
+				set(row, col, boolOrError(result[2], true))
+			}
+		case recordString:
+			if pendingRow < 0 {
+				continue
+			}
+			value, _, err := unicodeString(data, 2)
+			if err != nil {
+				return nil, err
+			}
+			set(pendingRow, pendingCol, value)
+			pendingRow, pendingCol = -1, -1
+		}
+	}
+}
+
+// cellPos is the row and column at the start of a cell record
+func cellPos(data []byte) (int, int) {
+	return int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:]))
+}
+
+// cellXF is the index of a cell's format record
+func cellXF(data []byte) uint16 {
+	return binary.LittleEndian.Uint16(data[4:])
+}
+
+// decodeRK reads Excel's compressed number format: either a 30-bit
+// integer or the top 30 bits of a double, optionally divided by 100
+func decodeRK(rk uint32) float64 {
+	var value float64
+	if rk&0x02 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		value /= 100
+	}
+	return value
+}
+
+func boolOrError(value byte, isError bool) string {
+	if isError {
+		return cellErrors[value]
+	}
+	if value != 0 {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// unicodeString reads a BIFF8 string whose character count takes
+// countBytes bytes, followed by an options byte. It returns the string and
+// the number of bytes read.
+func unicodeString(data []byte, countBytes int) (string, int, error) {
+	if len(data) < countBytes+1 {
+		return "", 0, errTruncated
+	}
+	count := int(data[0])
+	if countBytes == 2 {
+		count = int(binary.LittleEndian.Uint16(data))
+	}
+	flags := data[countBytes]
+	pos := countBytes + 1
+	if flags&0x08 != 0 {
+		pos += 2
+	}
+	if flags&0x04 != 0 {
+		pos += 4
+	}
+	if flags&0x01 != 0 {
+		if pos+2*count > len(data) {
+			return "", 0, errTruncated
+		}
+		units := make([]uint16, count)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[pos+2*i:])
+		}
+		return string(utf16.Decode(units)), pos + 2*count, nil
+	}
+	if pos+count > len(data) {
+		return "", 0, errTruncated
+	}
+	return latin1(data[pos : pos+count]), pos + count, nil
+}
+
+// latin1 decodes compressed BIFF8 characters, which are the low bytes of
+// UTF-16 code units
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// continued reads data split over a record and its CONTINUE records.
+// Characters cut by a CONTINUE resume after a fresh options byte, which
+// may switch between compressed and UTF-16 characters.
+type continued struct {
+	segments [][]byte
+	seg, pos int
+}
+
+func (c *continued) bytes(n int) ([]byte, error) {
+	var out []byte
+	for n > 0 {
+		if c.seg >= len(c.segments) {
+			return nil, errTruncated
+		}
+		segment := c.segments[c.seg]
+		if c.pos >= len(segment) {
+			c.seg++
+			c.pos = 0
+			continue
+		}
+		take := min(n, len(segment)-c.pos)
+		out = append(out, segment[c.pos:c.pos+take]...)
+		c.pos += take
+		n -= take
+	}
+	return out, nil
+}
+
+func (c *continued) chars(n int, wide bool) (string, error) {
+	units := make([]uint16, 0, n)
+	for len(units) < n {
+		if c.seg >= len(c.segments) {
+			return "", errTruncated
+		}
+		segment := c.segments[c.seg]
+		if c.pos >= len(segment) {
+			c.seg++
+			if c.seg >= len(c.segments) || len(c.segments[c.seg]) == 0 {
+				return "", errTruncated
+			}
+			wide = c.segments[c.seg][0]&0x01 != 0
+			c.pos = 1
+			continue
+		}
+		if wide {
+			if c.pos+2 > len(segment) {
+				return "", errTruncated
+			}
+			units = append(units, binary.LittleEndian.Uint16(segment[c.pos:]))
+			c.pos += 2
+		} else {
+			units = append(units, uint16(segment[c.pos]))
+			c.pos++
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// sharedStrings reads the shared string table, skipping the rich text
+// runs and phonetic data that may follow each string
+func sharedStrings(segments [][]byte) ([]string, error) {
+	c := &continued{segments: segments}
+	header, err := c.bytes(8)
+	if err != nil {
+		return nil, err
+	}
+	unique := int(binary.LittleEndian.Uint32(header[4:]))
+	values := make([]string, 0, min(unique, 1<<16))
+	for range unique {
+		head, err := c.bytes(3)
+		if err != nil {
+			return nil, err
+		}
+		count := int(binary.LittleEndian.Uint16(head))
+		flags := head[2]
+		runs, extra := 0, 0
+		if flags&0x08 != 0 {
+			b, err := c.bytes(2)
+			if err != nil {
+				return nil, err
+			}
+			runs = int(binary.LittleEndian.Uint16(b))
+		}
+		if flags&0x04 != 0 {
+			b, err := c.bytes(4)
+			if err != nil {
+				return nil, err
+			}
+			extra = int(binary.LittleEndian.Uint32(b))
+		}
+		value, err := c.chars(count, flags&0x01 != 0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.bytes(4*runs + extra); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
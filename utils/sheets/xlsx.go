@@ -0,0 +1,56 @@
+package sheets
+
+import (
+	"stockbackend/utils/upload"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type xlsxWorkbook struct {
+	f *excelize.File
+}
+
+// OpenXLSX opens the XLSX workbook at path within the unzip limits of
+// opts. Worksheets and shared strings larger than UnzipXMLSizeLimit are
+// unzipped to temp files, and their rows are streamed from there.
+func OpenXLSX(path string, opts Options) (Workbook, error) {
+	f, err := excelize.OpenFile(path, excelize.Options{
+		UnzipSizeLimit:    opts.UnzipSizeLimit,
+		UnzipXMLSizeLimit: opts.UnzipXMLSizeLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxWorkbook{f: f}, nil
+}
+
+func (w *xlsxWorkbook) Format() string {
+	return upload.KindXLSX
+}
+
+func (w *xlsxWorkbook) Sheets() []string {
+	return w.f.GetSheetList()
+}
+
+func (w *xlsxWorkbook) Rows(sheet string, fn func(row []string) bool) error {
+	rows, err := w.f.Rows(sheet)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		if !fn(row) {
+			return nil
+		}
+	}
+	return rows.Error()
+}
+
+func (w *xlsxWorkbook) Close() error {
+	return w.f.Close()
+}
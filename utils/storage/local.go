@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps blobs as files under a directory
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a store in dir, ./archive when empty, creating it if needed
+func NewLocal(dir string) (*Local, error) {
+	if dir == "" {
+		dir = "./archive"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating storage directory: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, content io.ReadSeeker, size int64) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	target := filepath.Join(l.dir, filepath.FromSlash(key))
+	if _, err := os.Stat(target); err == nil {
+		return target, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first so a failed copy never leaves a
+	// partial blob under the final key
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func (l *Local) Backend() string {
+	return BackendLocal
+}
@@ -0,0 +1,102 @@
+// Package storage archives uploaded files in a configurable blob store.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Backends
+const (
+	BackendNone  = "none"
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ErrInvalidKey is returned for keys that are empty or leave the store
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Store keeps blobs by key. Keys are content hashes, so a key that is
+// already stored is not written again.
+type Store interface {
+	// Put stores content under key and returns where it lives
+	Put(ctx context.Context, key string, content io.ReadSeeker, size int64) (string, error)
+	// Backend names the kind of store, one of the Backend constants
+	Backend() string
+}
+
+// Config selects and configures a backend
+type Config struct {
+	Backend  string
+	LocalDir string
+	S3       S3Config
+}
+
+// ConfigFromEnv reads STORAGE_BACKEND (none, local or s3, default none),
+// STORAGE_LOCAL_DIR and the S3_* variables
+func ConfigFromEnv() Config {
+	return Config{
+		Backend:  strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND"))),
+		LocalDir: os.Getenv("STORAGE_LOCAL_DIR"),
+		S3: S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		},
+	}
+}
+
+// New returns the store the config selects
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "", BackendNone:
+		return Noop{}, nil
+	case BackendLocal:
+		return NewLocal(cfg.LocalDir)
+	case BackendS3:
+		return NewS3(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+}
+
+// ContentKey hashes content and returns its key, <prefix>/<sha256><ext>,
+// with the hash. The content is rewound afterwards.
+func ContentKey(prefix, ext string, content io.ReadSeeker) (string, string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	return path.Join(prefix, sum+strings.ToLower(ext)), sum, nil
+}
+
+// validKey rejects keys that are empty, absolute or climb out of the store
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// Noop discards everything; it is the store when archiving is off
+type Noop struct{}
+
+func (Noop) Put(ctx context.Context, key string, content io.ReadSeeker, size int64) (string, error) {
+	return "", nil
+}
+
+func (Noop) Backend() string {
+	return BackendNone
+}
@@ -0,0 +1,281 @@
+// Package upload saves files uploaded by clients into a private temporary
+// directory per request, after checking their size and content.
+package upload
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+	// ErrFileTooLarge is returned for a file over Limits.MaxFileBytes
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrRequestTooLarge is returned once the files of a request add up to
+	// more than Limits.MaxRequestBytes
+	ErrRequestTooLarge = errors.New("upload too large")
+	// ErrTooManyFiles is returned for requests with more than Limits.MaxFiles files
+	ErrTooManyFiles = errors.New("too many files")
+	// ErrUnsupportedType is returned for files that are not XLSX, XLS or CSV
+	ErrUnsupportedType = errors.New("unsupported file type")
+	// ErrCompressionBomb is returned for XLSX files that would unzip to
+	// more than Limits.MaxUnzippedBytes or by more than Limits.MaxCompressionRatio
+	ErrCompressionBomb = errors.New("file expands too much when unzipped")
+)
+
+// Kinds of file accepted
+const (
+	KindXLSX = "xlsx"
+	KindXLS  = "xls"
+	KindCSV  = "csv"
+)
+
+// sniffBytes is how much of a file is read to tell its kind
+const sniffBytes = 8192
+
+var (
+	zipMagic = []byte("PK\x03\x04")
+	oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+)
+
+// Limits bound what one request may upload
+type Limits struct {
+	MaxFileBytes        int64
+	MaxRequestBytes     int64
+	MaxFiles            int
+	MaxUnzippedBytes    int64
+	MaxCompressionRatio int64
+}
+
+// LimitsFromEnv reads UPLOAD_MAX_FILE_MB (default 20), UPLOAD_MAX_REQUEST_MB
+// (50), UPLOAD_MAX_FILES (10), XLSX_UNZIP_LIMIT_MB (256) and
+// UPLOAD_MAX_COMPRESSION_RATIO (100)
+func LimitsFromEnv() Limits {
+	return Limits{
+		MaxFileBytes:        int64(envInt("UPLOAD_MAX_FILE_MB", 20)) << 20,
+		MaxRequestBytes:     int64(envInt("UPLOAD_MAX_REQUEST_MB", 50)) << 20,
+		MaxFiles:            envInt("UPLOAD_MAX_FILES", 10),
+		MaxUnzippedBytes:    int64(envInt("XLSX_UNZIP_LIMIT_MB", 256)) << 20,
+		MaxCompressionRatio: int64(envInt("UPLOAD_MAX_COMPRESSION_RATIO", 100)),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// Sniff tells the kind of a file from its first bytes. Zip archives are
+// taken to be XLSX and OLE2 compound files to be XLS; anything else must
+// be UTF-8 text without NUL bytes to pass as CSV.
+func Sniff(head []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(head, zipMagic):
+		return KindXLSX, nil
+	case bytes.HasPrefix(head, oleMagic):
+		return KindXLS, nil
+	}
+	text := bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF"))
+	if len(bytes.TrimSpace(text)) == 0 || bytes.IndexByte(text, 0) >= 0 {
+		return "", ErrUnsupportedType
+	}
+	// The sniffed bytes may end in the middle of a multi-byte character
+	for i := 0; i < utf8.UTFMax && !utf8.Valid(text); i++ {
+		text = text[:len(text)-1]
+	}
+	if !utf8.Valid(text) {
+		return "", ErrUnsupportedType
+	}
+	return KindCSV, nil
+}
+
+// CheckXLSX makes sure the file is a workbook and that its declared
+// uncompressed size stays within the limits. Excelize enforces the same
+// total while unzipping, in case the declared sizes lie.
+func CheckXLSX(path string, limits Limits) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	defer archive.Close()
+
+	var compressed, uncompressed uint64
+	workbook := false
+	for _, entry := range archive.File {
+		compressed += entry.CompressedSize64
+		uncompressed += entry.UncompressedSize64
+		if entry.Name == "xl/workbook.xml" {
+			workbook = true
+		}
+	}
+	if !workbook {
+		return fmt.Errorf("%w: zip file is not a workbook", ErrUnsupportedType)
+	}
+	if limits.MaxUnzippedBytes > 0 && uncompressed > uint64(limits.MaxUnzippedBytes) {
+		return fmt.Errorf("%w: %d bytes unzipped", ErrCompressionBomb, uncompressed)
+	}
+	if limits.MaxCompressionRatio > 0 && uncompressed > uint64(limits.MaxCompressionRatio)*max(compressed, 1) {
+		return fmt.Errorf("%w: compression ratio over %d", ErrCompressionBomb, limits.MaxCompressionRatio)
+	}
+	return nil
+}
+
+// Session holds the files of one request in its own temporary directory.
+// Cleanup removes the directory; it is safe to call more than once.
+type Session struct {
+	dir    string
+	limits Limits
+	total  int64
+	count  int
+
+	cleanupOnce sync.Once
+	detached    bool
+}
+
+// NewSession creates a temporary directory for a request under
+// UPLOAD_DIR, or the system temp directory when unset
+func NewSession(limits Limits) (*Session, error) {
+	base := os.Getenv("UPLOAD_DIR")
+	if base != "" {
+		if err := os.MkdirAll(base, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := os.MkdirTemp(base, "upload-")
+	if err != nil {
+		return nil, err
+	}
+	return &Session{dir: dir, limits: limits}, nil
+}
+
+// Dir is the directory the session saves to
+func (s *Session) Dir() string {
+	return s.dir
+}
+
+// Save checks an uploaded file and copies it into the session. Each file
+// gets its own subdirectory so uploads with the same name never collide;
+// the file keeps the client's base name with the extension of its kind.
+func (s *Session) Save(file *multipart.FileHeader) (string, error) {
+	if s.limits.MaxFileBytes > 0 && file.Size > s.limits.MaxFileBytes {
+		return "", fmt.Errorf("%w: %s", ErrFileTooLarge, file.Filename)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return s.saveReader(file.Filename, src)
+}
+
+func (s *Session) saveReader(filename string, src io.Reader) (string, error) {
+	s.count++
+	if s.limits.MaxFiles > 0 && s.count > s.limits.MaxFiles {
+		return "", fmt.Errorf("%w: at most %d", ErrTooManyFiles, s.limits.MaxFiles)
+	}
+	head := make([]byte, sniffBytes)
+	n, err := io.ReadFull(src, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	kind, err := Sniff(head[:n])
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, filename)
+	}
+
+	fileDir := filepath.Join(s.dir, strconv.Itoa(s.count))
+	if err := os.Mkdir(fileDir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(fileDir, safeName(filename, kind))
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	// Read one byte past each limit to tell "at the limit" from "over it"
+	limit := int64(-1)
+	if s.limits.MaxFileBytes > 0 {
+		limit = s.limits.MaxFileBytes
+	}
+	if s.limits.MaxRequestBytes > 0 && (limit < 0 || s.limits.MaxRequestBytes-s.total < limit) {
+		limit = s.limits.MaxRequestBytes - s.total
+	}
+	reader := io.MultiReader(bytes.NewReader(head[:n]), src)
+	if limit >= 0 {
+		reader = io.LimitReader(reader, limit+1)
+	}
+	written, err := io.Copy(dst, reader)
+	if err != nil {
+		return "", err
+	}
+	if limit >= 0 && written > limit {
+		if s.limits.MaxFileBytes > 0 && written > s.limits.MaxFileBytes {
+			return "", fmt.Errorf("%w: %s", ErrFileTooLarge, filename)
+		}
+		return "", ErrRequestTooLarge
+	}
+	s.total += written
+
+	if kind == KindXLSX {
+		if err := CheckXLSX(path, s.limits); err != nil {
+			return "", fmt.Errorf("%w (%s)", err, filename)
+		}
+	}
+	return path, nil
+}
+
+// safeName keeps the base of the client's file name, without path or
+// unusual characters, and gives it the extension of its kind
+func safeName(filename, kind string) string {
+	base := filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == ' ', r == '.':
+			return r
+		}
+		return '_'
+	}, base)
+	base = strings.Trim(base, ". ")
+	if base == "" {
+		base = "upload"
+	}
+	if len(base) > 100 {
+		base = base[:100]
+	}
+	return base + "." + kind
+}
+
+// Detach hands the files over to someone else, such as a background job:
+// Cleanup no longer removes them and the returned function does instead
+func (s *Session) Detach() func() {
+	s.detached = true
+	return s.remove
+}
+
+// Cleanup removes the session's directory unless it was detached
+func (s *Session) Cleanup() {
+	if !s.detached {
+		s.remove()
+	}
+}
+
+func (s *Session) remove() {
+	s.cleanupOnce.Do(func() {
+		os.RemoveAll(s.dir)
+	})
+}
@@ -0,0 +1,158 @@
+package upload
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func workbookZip(t *testing.T, sheetBytes int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, size := range map[string]int{"xl/workbook.xml": 64, "xl/worksheets/sheet1.xml": sheetBytes} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(bytes.Repeat([]byte("0"), size))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     []byte
+		expected string
+	}{
+		{"xlsx", []byte("PK\x03\x04rest"), KindXLSX},
+		{"xls", append([]byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, 0, 0), KindXLS},
+		{"csv", []byte("ISIN,Name\nINE009A01021,Infosys\n"), KindCSV},
+		{"csv with BOM", []byte("\xEF\xBB\xBFISIN,Name\n"), KindCSV},
+		{"csv cut mid-character", []byte("Name\nNestlé")[:11], KindCSV},
+	}
+	for _, test := range tests {
+		kind, err := Sniff(test.head)
+		if err != nil || kind != test.expected {
+			t.Errorf("%s: expected %v, got %v, %v", test.name, test.expected, kind, err)
+		}
+	}
+
+	for _, head := range [][]byte{[]byte("%PDF-1.7\x00\x01"), {0xFF, 0xD8, 0xFF, 0xE0, 0x00}, {}, []byte("   ")} {
+		if _, err := Sniff(head); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("Expected ErrUnsupportedType for %q, got %v", head, err)
+		}
+	}
+}
+
+func TestSession_Save(t *testing.T) {
+	t.Setenv("UPLOAD_DIR", t.TempDir())
+	session, err := NewSession(Limits{MaxFileBytes: 1 << 20, MaxRequestBytes: 2 << 20, MaxUnzippedBytes: 1 << 20, MaxCompressionRatio: 100})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	first, err := session.saveReader("portfolio.xlsx", bytes.NewReader(workbookZip(t, 100)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	second, err := session.saveReader("portfolio.xlsx", bytes.NewReader(workbookZip(t, 200)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if first == second || filepath.Base(first) != "portfolio.xlsx" {
+		t.Errorf("Expected separate files keeping the name, got %v and %v", first, second)
+	}
+
+	// The extension follows the content, not the name
+	csv, err := session.saveReader("../../etc/holdings.xlsx", strings.NewReader("ISIN,Name\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if filepath.Base(csv) != "holdings.csv" || !strings.HasPrefix(csv, session.Dir()) {
+		t.Errorf("Expected holdings.csv inside the session, got %v", csv)
+	}
+
+	session.Cleanup()
+	if _, err := os.Stat(session.Dir()); !os.IsNotExist(err) {
+		t.Errorf("Expected session directory to be removed, got %v", err)
+	}
+}
+
+func TestSession_Limits(t *testing.T) {
+	t.Setenv("UPLOAD_DIR", t.TempDir())
+	session, err := NewSession(Limits{MaxFileBytes: 100, MaxRequestBytes: 150})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer session.Cleanup()
+
+	if _, err := session.saveReader("big.csv", strings.NewReader(strings.Repeat("a,b\n", 30))); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge, got %v", err)
+	}
+	if _, err := session.saveReader("a.csv", strings.NewReader(strings.Repeat("a", 90))); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := session.saveReader("b.csv", strings.NewReader(strings.Repeat("b", 90))); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("Expected ErrRequestTooLarge, got %v", err)
+	}
+	if _, err := session.saveReader("photo.csv", bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0x00})); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestCheckXLSX(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	limits := Limits{MaxUnzippedBytes: 1 << 20, MaxCompressionRatio: 100}
+
+	if err := CheckXLSX(write("ok.xlsx", workbookZip(t, 1000)), limits); err != nil {
+		t.Errorf("Expected workbook to pass, got %v", err)
+	}
+	if err := CheckXLSX(write("bomb.xlsx", workbookZip(t, 4<<20)), limits); !errors.Is(err, ErrCompressionBomb) {
+		t.Errorf("Expected ErrCompressionBomb, got %v", err)
+	}
+	if err := CheckXLSX(write("ratio.xlsx", workbookZip(t, 512<<10)), limits); !errors.Is(err, ErrCompressionBomb) {
+		t.Errorf("Expected ErrCompressionBomb for the ratio, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, _ := archive.Create("readme.txt")
+	w.Write([]byte("not a workbook"))
+	archive.Close()
+	if err := CheckXLSX(write("plain.zip", buf.Bytes()), limits); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected ErrUnsupportedType for a plain zip, got %v", err)
+	}
+}
+
+func TestSession_Detach(t *testing.T) {
+	t.Setenv("UPLOAD_DIR", t.TempDir())
+	session, err := NewSession(Limits{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cleanup := session.Detach()
+	session.Cleanup()
+	if _, err := os.Stat(session.Dir()); err != nil {
+		t.Errorf("Expected detached session to survive Cleanup, got %v", err)
+	}
+	cleanup()
+	if _, err := os.Stat(session.Dir()); !os.IsNotExist(err) {
+		t.Errorf("Expected detached cleanup to remove the directory, got %v", err)
+	}
+}